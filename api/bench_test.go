@@ -0,0 +1,145 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+)
+
+func BenchmarkPushPop(b *testing.B) {
+	L := NewState()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		L.PushInteger(1)
+		L.PushNumber(2.5)
+		L.PushString("x")
+		L.PushBoolean(true)
+		L.PushNil()
+		L.Pop(5)
+	}
+}
+
+func BenchmarkRotate(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			L := NewState()
+			L.CheckStack(n)
+			for i := 0; i < n; i++ {
+				L.PushInteger(int64(i))
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				L.Rotate(1, 1)
+			}
+		})
+	}
+}
+
+func BenchmarkCopy(b *testing.B) {
+	L := NewState()
+	L.PushString("x")
+	L.PushInteger(1)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		L.Copy(1+i%2, 2-i%2)
+	}
+}
+
+func BenchmarkToNumber(b *testing.B) {
+	L := NewState()
+	L.PushInteger(42)
+	L.PushString("0x10")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		L.ToNumber(-1 - i%2)
+	}
+}
+
+var arithOps = []struct {
+	name string
+	op   ArithOp
+}{
+	{"add", LUA_OPADD}, {"sub", LUA_OPSUB}, {"mul", LUA_OPMUL}, {"mod", LUA_OPMOD},
+	{"pow", LUA_OPPOW}, {"div", LUA_OPDIV}, {"idiv", LUA_OPIDIV}, {"band", LUA_OPBAND},
+	{"bor", LUA_OPBOR}, {"bxor", LUA_OPBXOR}, {"shl", LUA_OPSHL}, {"shr", LUA_OPSHR},
+	{"unm", LUA_OPUNM}, {"bnot", LUA_OPBNOT},
+}
+
+/* operands of each kind; floats have an integer value so bitwise operations work */
+var operands = []struct {
+	name string
+	push func(L *LuaState, n int64)
+}{
+	{"int", func(L *LuaState, n int64) { L.PushInteger(n) }},
+	{"float", func(L *LuaState, n int64) { L.PushNumber(float64(n)) }},
+	{"string", func(L *LuaState, n int64) { L.PushString(fmt.Sprint(n)) }},
+}
+
+func BenchmarkArith(b *testing.B) {
+	for _, op := range arithOps {
+		for _, kind := range operands {
+			unary := op.op == LUA_OPUNM || op.op == LUA_OPBNOT
+			b.Run(op.name+"/"+kind.name, func(b *testing.B) {
+				L := NewState()
+				kind.push(L, 7)
+				kind.push(L, 3)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					L.PushValue(1)
+					if !unary {
+						L.PushValue(2)
+					}
+					L.Arith(op.op)
+					L.Pop(1)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkCompare(b *testing.B) {
+	ops := []struct {
+		name string
+		op   CompareOp
+	}{{"eq", LUA_OPEQ}, {"lt", LUA_OPLT}, {"le", LUA_OPLE}}
+	kinds := []struct {
+		name string
+		push func(L *LuaState)
+	}{
+		{"int", func(L *LuaState) { L.PushInteger(1); L.PushInteger(2) }},
+		{"float", func(L *LuaState) { L.PushNumber(1.5); L.PushNumber(2.5) }},
+		{"mixed", func(L *LuaState) { L.PushInteger(1); L.PushNumber(2.5) }},
+		{"string", func(L *LuaState) { L.PushString("abc"); L.PushString("abd") }},
+	}
+	for _, op := range ops {
+		for _, kind := range kinds {
+			b.Run(op.name+"/"+kind.name, func(b *testing.B) {
+				L := NewState()
+				kind.push(L)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					L.Compare(1, 2, op.op)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkConcat(b *testing.B) {
+	for _, n := range []int{2, 16, 256} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			L := NewState()
+			L.CheckStack(n)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < n; j++ {
+					L.PushString("abcdefgh")
+				}
+				L.Concat(n)
+				L.Pop(1)
+			}
+		})
+	}
+}
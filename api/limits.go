@@ -0,0 +1,45 @@
+package api
+
+import "fmt"
+
+/* maximum number of stack slots when no limit is set */
+const LUAI_MAXSTACK = 1000000
+
+/* budgets for sandboxed execution; zero means the default (or no limit) */
+type Limits struct {
+	MaxStack       int // maximum number of stack slots
+	MaxStringBytes int // total bytes of strings created by the state
+}
+
+/* error raised when a state exhausts one of its budgets; scripts must not be able to catch it */
+type LimitError struct {
+	What  string
+	Limit int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit exceeded (%d)", e.What, e.Limit)
+}
+
+func (L *LuaState) SetLimits(limits Limits) {
+	L.limits = limits
+}
+
+func (L *LuaState) maxStack() int {
+	if L.limits.MaxStack > 0 && L.limits.MaxStack < LUAI_MAXSTACK {
+		return L.limits.MaxStack
+	}
+	return LUAI_MAXSTACK
+}
+
+func (L *LuaState) stackOverflow() *LimitError {
+	return &LimitError{"stack", L.maxStack()}
+}
+
+/* account for a newly created string of n bytes */
+func (L *LuaState) chargeString(n int) {
+	L.stringBytes += n
+	if max := L.limits.MaxStringBytes; max > 0 && L.stringBytes > max {
+		panic(&LimitError{"string memory", max})
+	}
+}
@@ -1,8 +1,8 @@
 package api
 
 func (L *LuaState) stackPush(val luaValue) {
-	if len(L.stack) == cap(L.stack) {
-		panic("stack overflow")
+	if !L.CheckStack(1) {
+		panic(L.stackOverflow())
 	}
 	L.stack = append(L.stack, val)
 }
@@ -14,7 +14,7 @@ func (L *LuaState) stackPop() luaValue {
 	}
 	top--
 	val := L.stack[top]
-	L.stack[top] = nil
+	L.stack[top] = luaValue{}
 	L.stack = L.stack[:top]
 	return val
 }
@@ -25,7 +25,7 @@ func (L *LuaState) stackGet(idx int) (luaValue, bool) {
 		if idx <= len(L.stack) {
 			return L.stack[idx-1], true
 		}
-		return nil, false
+		return luaValue{}, false
 	}
 	panic("unacceptable index")
 }
@@ -1,14 +1,23 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"math"
+	"unsafe"
 
 	"github.com/uganh16/luago/number"
 )
 
 type LuaState struct {
-	stack []luaValue
+	stack       []luaValue
+	gcStopped   bool
+	gcPause     int
+	gcStepMul   int
+	limits      Limits
+	stringBytes int
+	strings     map[string]string // interned strings of loaded chunks
+	ctx         context.Context
 }
 
 /**
@@ -17,7 +26,48 @@ type LuaState struct {
 
 func NewState() *LuaState {
 	return &LuaState{
-		stack: make([]luaValue, 0, 20),
+		stack:     make([]luaValue, 0, 20),
+		gcPause:   LUAI_GCPAUSE,
+		gcStepMul: LUAI_GCMUL,
+		ctx:       context.Background(),
+	}
+}
+
+/*
+ * attach a context; once it is done, Arith and Concat raise a
+ * *ContextError wrapping ctx.Err() instead of running
+ */
+func (L *LuaState) SetContext(ctx context.Context) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	L.ctx = ctx
+}
+
+func (L *LuaState) Context() context.Context {
+	return L.ctx
+}
+
+/* error raised when the context of a state is done */
+type ContextError struct {
+	Err error // ctx.Err()
+}
+
+func (e *ContextError) Error() string {
+	return "execution aborted: " + e.Err.Error()
+}
+
+func (e *ContextError) Unwrap() error {
+	return e.Err
+}
+
+func (L *LuaState) checkContext() {
+	if done := L.ctx.Done(); done != nil {
+		select {
+		case <-done:
+			panic(&ContextError{L.ctx.Err()})
+		default:
+		}
 	}
 }
 
@@ -39,22 +89,25 @@ func (L *LuaState) GetTop() int {
 func (L *LuaState) SetTop(idx int) {
 	top := len(L.stack)
 	if idx >= 0 {
+		if idx > L.maxStack() {
+			panic(L.stackOverflow())
+		}
 		if idx > cap(L.stack) {
 			panic("new top too large")
 		}
 		for top < idx {
-			L.stack = append(L.stack, nil)
+			L.stack = append(L.stack, luaValue{})
 			top++
 		}
 	} else {
-		if -idx > top {
+		if -idx-1 > top {
 			panic("invalid new top")
 		}
 		idx = top + idx + 1
 	}
 	for top > idx {
 		top--
-		L.stack[top] = nil
+		L.stack[top] = luaValue{}
 	}
 	L.stack = L.stack[:top]
 }
@@ -90,10 +143,15 @@ func (L *LuaState) Copy(srcIdx, dstIdx int) {
 }
 
 func (L *LuaState) CheckStack(n int) bool {
+	if len(L.stack)+n > L.maxStack() {
+		return false
+	}
 	if cap(L.stack)-len(L.stack) < n {
 		newSize := cap(L.stack) * 2
 		if newSize < len(L.stack)+n {
 			newSize = len(L.stack) + n
+		} else if newSize > L.maxStack() {
+			newSize = L.maxStack()
 		}
 		newStack := make([]luaValue, len(L.stack), newSize)
 		copy(newStack, L.stack)
@@ -118,8 +176,7 @@ func (L *LuaState) IsString(idx int) bool {
 
 func (L *LuaState) IsInteger(idx int) bool {
 	val, _ := L.stackGet(idx)
-	_, ok := val.(int64)
-	return ok
+	return val.isInteger()
 }
 
 func (L *LuaState) Type(idx int) LuaType {
@@ -173,10 +230,11 @@ func (L *LuaState) ToBoolean(idx int) bool {
 
 func (L *LuaState) ToStringX(idx int) (string, bool) {
 	val, _ := L.stackGet(idx)
-	if str, ok := val.(string); ok {
-		return str, ok
-	} else if str, ok = toString(val); ok {
-		L.stackSet(idx, str)
+	if val.isString() {
+		return val.s, true
+	} else if str, ok := toString(val); ok {
+		L.chargeString(len(str))
+		L.stackSet(idx, stringValue(str))
 		return str, ok
 	}
 	return "", false
@@ -206,7 +264,8 @@ const (
 type ArithOp = int
 
 func (L *LuaState) Arith(op ArithOp) {
-	var a, b, r luaValue
+	L.checkContext()
+	var a, b, r luaValue // r stays nil until the operation succeeds
 	b = L.stackPop()
 	if op != LUA_OPUNM && op != LUA_OPBNOT {
 		a = L.stackPop()
@@ -228,14 +287,24 @@ func (L *LuaState) Arith(op ArithOp) {
 		iFunc = func(a, b int64) int64 { return a * b }
 		fFunc = func(a, b float64) float64 { return a * b }
 	case LUA_OPMOD:
-		iFunc = number.IMod
+		iFunc = func(a, b int64) int64 {
+			if b == 0 {
+				panic(runtimeError("attempt to perform 'n%0'"))
+			}
+			return number.IMod(a, b)
+		}
 		fFunc = number.FMod
 	case LUA_OPPOW:
 		fFunc = math.Pow
 	case LUA_OPDIV:
 		fFunc = func(a, b float64) float64 { return a / b }
 	case LUA_OPIDIV:
-		iFunc = number.IFloorDiv
+		iFunc = func(a, b int64) int64 {
+			if b == 0 {
+				panic(runtimeError("attempt to perform 'n//0'"))
+			}
+			return number.IFloorDiv(a, b)
+		}
 		fFunc = number.FFloorDiv
 	case LUA_OPBAND:
 		iFunc = func(a, b int64) int64 { return a & b }
@@ -259,28 +328,26 @@ func (L *LuaState) Arith(op ArithOp) {
 	if fFunc == nil { // bitwise operation
 		if a, ok := toInteger(a); ok {
 			if b, ok := toInteger(b); ok {
-				r = iFunc(a, b)
+				r = integerValue(iFunc(a, b))
 			}
 		}
 	} else {
 		if iFunc != nil {
-			if a, ok := a.(int64); ok {
-				if b, ok := b.(int64); ok {
-					r = iFunc(a, b)
-				}
+			if a.isInteger() && b.isInteger() {
+				r = integerValue(iFunc(a.integer(), b.integer()))
 			}
 		}
 
-		if r == nil {
+		if typeOf(r) == LUA_TNIL {
 			if a, ok := toNumber(a); ok {
 				if b, ok := toNumber(b); ok {
-					r = fFunc(a, b)
+					r = floatValue(fFunc(a, b))
 				}
 			}
 		}
 	}
 
-	if r != nil {
+	if typeOf(r) != LUA_TNIL {
 		L.stackPush(r)
 	} else {
 		switch op {
@@ -335,23 +402,95 @@ func (L *LuaState) Compare(idx1, idx2 int, op CompareOp) bool {
  */
 
 func (L *LuaState) PushNil() {
-	L.stackPush(nil)
+	L.stackPush(luaValue{})
 }
 
 func (L *LuaState) PushNumber(n float64) {
-	L.stackPush(n)
+	L.stackPush(floatValue(n))
 }
 
 func (L *LuaState) PushInteger(n int64) {
-	L.stackPush(n)
+	L.stackPush(integerValue(n))
 }
 
 func (L *LuaState) PushString(s string) {
-	L.stackPush(s)
+	L.chargeString(len(s))
+	L.stackPush(stringValue(s))
 }
 
 func (L *LuaState) PushBoolean(b bool) {
-	L.stackPush(b)
+	L.stackPush(booleanValue(b))
+}
+
+/**
+ * garbage-collection function and options
+ */
+
+const (
+	LUA_GCSTOP       = 0
+	LUA_GCRESTART    = 1
+	LUA_GCCOLLECT    = 2
+	LUA_GCCOUNT      = 3
+	LUA_GCCOUNTB     = 4
+	LUA_GCSTEP       = 5
+	LUA_GCSETPAUSE   = 6
+	LUA_GCSETSTEPMUL = 7
+	LUA_GCISRUNNING  = 9
+)
+
+const (
+	LUAI_GCPAUSE = 200 // 200%
+	LUAI_GCMUL   = 200 // GC runs 'twice the speed' of memory allocation
+)
+
+type GCOp = int
+
+/*
+ * Values live in Go memory and are reclaimed by the Go collector, which a
+ * state cannot run, pause or step without affecting the whole process.
+ * LUA_GCCOLLECT and LUA_GCSTEP therefore do nothing; the counts report the
+ * memory the state holds now (its stack slots and the strings on them);
+ * LUA_GCSTOP and the tuning options only record and report their arguments.
+ */
+func (L *LuaState) GC(what GCOp, data int) int {
+	switch what {
+	case LUA_GCSTOP:
+		L.gcStopped = true
+	case LUA_GCRESTART:
+		L.gcStopped = false
+	case LUA_GCCOLLECT:
+		// unreachable values go with the next Go collection
+	case LUA_GCCOUNT:
+		return L.memoryInUse() >> 10 // in Kbytes
+	case LUA_GCCOUNTB:
+		return L.memoryInUse() & 0x3ff
+	case LUA_GCSTEP:
+		return 0 // no incremental collector, so a step never ends a cycle
+	case LUA_GCSETPAUSE:
+		res := L.gcPause
+		L.gcPause = data
+		return res
+	case LUA_GCSETSTEPMUL:
+		res := L.gcStepMul
+		L.gcStepMul = data
+		return res
+	case LUA_GCISRUNNING:
+		if L.gcStopped {
+			return 0
+		}
+		return 1
+	default:
+		return -1 // invalid option
+	}
+	return 0
+}
+
+func (L *LuaState) memoryInUse() int {
+	n := cap(L.stack) * int(unsafe.Sizeof(luaValue{}))
+	for _, val := range L.stack {
+		n += len(val.s)
+	}
+	return n
 }
 
 /**
@@ -359,8 +498,9 @@ func (L *LuaState) PushBoolean(b bool) {
  */
 
 func (L *LuaState) Concat(n int) {
+	L.checkContext()
 	if n == 0 {
-		L.stackPush("")
+		L.stackPush(stringValue(""))
 	}
 	if n >= 2 {
 		b := L.stackPop()
@@ -369,7 +509,8 @@ func (L *LuaState) Concat(n int) {
 			n--
 			if s1, ok := toString(a); ok {
 				if s2, ok := toString(b); ok {
-					b = s1 + s2
+					L.chargeString(len(s1) + len(s2))
+					b = stringValue(s1 + s2)
 					continue
 				}
 			}
@@ -383,10 +524,31 @@ func (L *LuaState) Concat(n int) {
 	}
 }
 
+/* push the number s is a numeral of and report whether it is one */
+func (L *LuaState) StringToNumber(s string) bool {
+	n, ok := stringToNumber(s)
+	if ok {
+		L.stackPush(n)
+	}
+	return ok
+}
+
+/* the copy of s shared by every chunk loaded into L (see binary.UndumpInterned) */
+func (L *LuaState) Intern(s string) string {
+	if shared, ok := L.strings[s]; ok {
+		return shared
+	}
+	if L.strings == nil {
+		L.strings = map[string]string{}
+	}
+	L.strings[s] = s
+	return s
+}
+
 func (L *LuaState) Len(idx int) {
 	val, _ := L.stackGet(idx)
-	if str, ok := val.(string); ok {
-		L.stackPush(int64(len(str)))
+	if val.isString() {
+		L.stackPush(integerValue(int64(len(val.s))))
 	} else {
 		typeError(L, val, "get length of")
 	}
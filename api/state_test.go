@@ -1,8 +1,12 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"testing"
+	"unsafe"
 )
 
 func TestStack(t *testing.T) {
@@ -30,6 +34,27 @@ func TestStack(t *testing.T) {
 	printStack(L)
 }
 
+func TestSetTop(t *testing.T) {
+	L := NewState()
+	L.PushInteger(1)
+	L.PushInteger(2)
+	L.SetTop(-3) // empties the stack
+	if L.GetTop() != 0 {
+		t.Errorf("SetTop(-3) left %d values", L.GetTop())
+	}
+	L.PushInteger(1)
+	L.Pop(1)
+	if L.GetTop() != 0 {
+		t.Errorf("Pop(1) left %d values", L.GetTop())
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("SetTop(-2) on an empty stack did not panic")
+		}
+	}()
+	L.SetTop(-2)
+}
+
 func TestLuaOp(t *testing.T) {
 	L := NewState()
 	L.PushInteger(1)
@@ -66,3 +91,200 @@ func printStack(L *LuaState) {
 	}
 	fmt.Println()
 }
+
+func TestLimits(t *testing.T) {
+	L := NewState()
+	L.SetLimits(Limits{MaxStack: 30, MaxStringBytes: 16})
+	if L.CheckStack(31) {
+		t.Errorf("CheckStack(31) succeeded with MaxStack 30")
+	}
+	for i := 0; i < 30; i++ {
+		L.PushInteger(int64(i))
+	}
+	func() {
+		defer func() {
+			if _, ok := recover().(*LimitError); !ok {
+				t.Errorf("stack limit error expected")
+			}
+		}()
+		L.PushNil()
+	}()
+
+	L.SetTop(0)
+	L.PushString("hello, ")
+	L.PushString("world")
+	func() {
+		defer func() {
+			if _, ok := recover().(*LimitError); !ok {
+				t.Errorf("string limit error expected")
+			}
+		}()
+		L.Concat(2)
+	}()
+}
+
+func TestSmallStackLimit(t *testing.T) {
+	L := NewState() // starts with room for more than 5 slots
+	L.SetLimits(Limits{MaxStack: 5})
+	if L.CheckStack(6) {
+		t.Errorf("CheckStack(6) succeeded with MaxStack 5")
+	}
+	for i := 0; i < 5; i++ {
+		L.PushInteger(int64(i))
+	}
+	for _, f := range []func(){L.PushNil, func() { L.SetTop(0); L.SetTop(6) }} {
+		func() {
+			defer func() {
+				r := recover()
+				if e, ok := r.(*LimitError); !ok || e.What != "stack" || e.Limit != 5 {
+					t.Errorf("got %v, want the stack limit error", r)
+				}
+			}()
+			f()
+		}()
+	}
+	L.SetTop(5)
+	if L.GetTop() != 5 {
+		t.Errorf("SetTop(5) left %d slots", L.GetTop())
+	}
+}
+
+func TestGC(t *testing.T) {
+	L := NewState()
+	before := L.GC(LUA_GCCOUNT, 0)<<10 + L.GC(LUA_GCCOUNTB, 0)
+	L.PushString(string(make([]byte, 4096)))
+	after := L.GC(LUA_GCCOUNT, 0)<<10 + L.GC(LUA_GCCOUNTB, 0)
+	if after-before != 4096 {
+		t.Errorf("count grew by %d bytes, want 4096", after-before)
+	}
+	if NewState().GC(LUA_GCCOUNT, 0) >= 4 {
+		t.Errorf("count of a new state includes another state's strings")
+	}
+	L.Pop(1)
+	L.GC(LUA_GCCOLLECT, 0)
+	if n := L.GC(LUA_GCCOUNT, 0)<<10 + L.GC(LUA_GCCOUNTB, 0); n != before {
+		t.Errorf("count is %d bytes after popping the string, want %d", n, before)
+	}
+	if L.GC(LUA_GCSTEP, 0) != 0 {
+		t.Errorf("step reported a finished cycle")
+	}
+	L.GC(LUA_GCSTOP, 0)
+	if L.GC(LUA_GCISRUNNING, 0) != 0 {
+		t.Errorf("collector running after LUA_GCSTOP")
+	}
+	if L.GC(LUA_GCSETPAUSE, 100) != LUAI_GCPAUSE || L.GC(LUA_GCSETPAUSE, 0) != 100 {
+		t.Errorf("LUA_GCSETPAUSE does not return the previous pause")
+	}
+}
+
+func TestContext(t *testing.T) {
+	L := NewState()
+	ctx, cancel := context.WithCancel(context.Background())
+	L.SetContext(ctx)
+	L.PushInteger(1)
+	L.PushInteger(2)
+	L.Arith(LUA_OPADD)
+	cancel()
+	for _, f := range []func(){
+		func() { L.Arith(LUA_OPUNM) },
+		func() { L.Concat(1) },
+	} {
+		func() {
+			defer func() {
+				err, ok := recover().(error)
+				if !ok || !errors.Is(err, context.Canceled) {
+					t.Errorf("got %v, want an error wrapping context.Canceled", err)
+				}
+			}()
+			f()
+		}()
+	}
+	if i := L.ToInteger(-1); i != 3 {
+		t.Errorf("stack changed by an aborted operation: %d", i)
+	}
+}
+
+func TestCompareIntFloat(t *testing.T) {
+	L := NewState()
+	L.PushInteger(math.MaxInt64)
+	L.PushNumber(math.Exp2(63))
+	L.PushInteger(1<<53 + 1)
+	L.PushNumber(1 << 53)
+	L.PushNumber(math.NaN())
+	for _, c := range []struct {
+		a, b int
+		op   CompareOp
+		want bool
+	}{
+		{1, 2, LUA_OPLT, true}, {1, 2, LUA_OPLE, true}, {1, 2, LUA_OPEQ, false},
+		{2, 1, LUA_OPLT, false}, {2, 1, LUA_OPLE, false},
+		{3, 4, LUA_OPLT, false}, {3, 4, LUA_OPLE, false}, {3, 4, LUA_OPEQ, false},
+		{4, 3, LUA_OPLT, true}, {4, 3, LUA_OPLE, true},
+		{1, 5, LUA_OPLT, false}, {1, 5, LUA_OPLE, false}, {5, 1, LUA_OPLT, false}, {5, 1, LUA_OPLE, false},
+	} {
+		if got := L.Compare(c.a, c.b, c.op); got != c.want {
+			t.Errorf("Compare(%d, %d, %d) = %t, want %t", c.a, c.b, c.op, got, c.want)
+		}
+	}
+}
+
+func TestNumberToString(t *testing.T) {
+	L := NewState()
+	L.PushNumber(1)
+	L.PushString("|")
+	L.PushNumber(1e15)
+	L.PushString("|")
+	L.PushInteger(-3)
+	L.Concat(5)
+	if s := L.ToString(-1); s != "1.0|1e+15|-3" {
+		t.Errorf("Concat gave %q, want %q", s, "1.0|1e+15|-3")
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	for _, c := range []struct {
+		op  ArithOp
+		msg string
+	}{{LUA_OPIDIV, "attempt to perform 'n//0'"}, {LUA_OPMOD, "attempt to perform 'n%0'"}} {
+		func() {
+			defer func() {
+				if err := recover(); err != runtimeError(c.msg) {
+					t.Errorf("got %v, want %q", err, c.msg)
+				}
+			}()
+			L := NewState()
+			L.PushInteger(1)
+			L.PushInteger(0)
+			L.Arith(c.op)
+		}()
+	}
+
+	L := NewState()
+	L.PushNumber(1)
+	L.PushInteger(0)
+	L.Arith(LUA_OPIDIV)
+	if f := L.ToNumber(-1); !math.IsInf(f, 1) {
+		t.Errorf("1.0 // 0 = %g, want inf", f)
+	}
+	L.PushInteger(math.MinInt64)
+	L.PushInteger(-1)
+	L.Arith(LUA_OPIDIV)
+	if i := L.ToInteger(-1); i != math.MinInt64 {
+		t.Errorf("math.mininteger // -1 = %d", i)
+	}
+}
+
+func TestIntern(t *testing.T) {
+	L := NewState()
+	a := L.Intern(string([]byte("print")))
+	b := L.Intern(string([]byte("print")))
+	data := func(s string) unsafe.Pointer { // unsafe.StringData from Go 1.20 on
+		return *(*unsafe.Pointer)(unsafe.Pointer(&s))
+	}
+	if a != "print" || data(a) != data(b) {
+		t.Errorf("equal strings not shared")
+	}
+	if L.Intern("x") != "x" || len(L.strings) != 2 {
+		t.Errorf("unexpected interned strings %v", L.strings)
+	}
+}
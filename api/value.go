@@ -1,7 +1,7 @@
 package api
 
 import (
-	"fmt"
+	"math"
 
 	"github.com/uganh16/luago/number"
 )
@@ -46,152 +46,182 @@ const (
 	LUA_TNUMINT = LUA_TNUMBER | (1 << 4)
 )
 
-type luaValue interface{}
+/*
+ * tagged value (TValue). Numbers and booleans are kept in n and strings in
+ * s, so no value is boxed on its way to or from the stack. The zero value
+ * is nil.
+ */
+type luaValue struct {
+	tt byte   // variant tag: LUA_TNIL, LUA_TBOOLEAN, LUA_TNUMINT, LUA_TNUMFLT or LUA_TSTRING
+	n  uint64 // integer, float bits or boolean
+	s  string
+}
 
-func typeOf(val luaValue) LuaType {
-	switch val.(type) {
-	case nil:
-		return LUA_TNIL
-	case bool:
-		return LUA_TBOOLEAN
-	case float64, int64:
-		return LUA_TNUMBER
-	case string:
-		return LUA_TSTRING
-	default:
-		panic(fmt.Sprintf("invalid value: %v (%T)", val, val))
+func booleanValue(b bool) luaValue {
+	if b {
+		return luaValue{tt: LUA_TBOOLEAN, n: 1}
 	}
+	return luaValue{tt: LUA_TBOOLEAN}
+}
+
+func integerValue(i int64) luaValue {
+	return luaValue{tt: LUA_TNUMINT, n: uint64(i)}
+}
+
+func floatValue(f float64) luaValue {
+	return luaValue{tt: LUA_TNUMFLT, n: math.Float64bits(f)}
+}
+
+func stringValue(s string) luaValue {
+	return luaValue{tt: LUA_TSTRING, s: s}
+}
+
+func (val luaValue) isInteger() bool {
+	return val.tt == LUA_TNUMINT
+}
+
+func (val luaValue) isString() bool {
+	return val.tt == LUA_TSTRING
+}
+
+func (val luaValue) integer() int64 {
+	return int64(val.n)
+}
+
+func (val luaValue) float() float64 {
+	return math.Float64frombits(val.n)
+}
+
+func typeOf(val luaValue) LuaType {
+	return LuaType(val.tt & 0x0f) // without variant bits
 }
 
 func toBoolean(val luaValue) bool {
-	switch val := val.(type) {
-	case nil:
+	switch val.tt {
+	case LUA_TNIL:
 		return false
-	case bool:
-		return val
+	case LUA_TBOOLEAN:
+		return val.n != 0
 	default:
 		return true
 	}
 }
 
 func toNumber(val luaValue) (float64, bool) {
-	switch val := val.(type) {
-	case float64:
-		return val, true
-	case int64:
-		return float64(val), true
-	case string:
-		return number.ParseFloat(val)
-	default:
-		return 0.0, false
+	switch val.tt {
+	case LUA_TNUMFLT:
+		return val.float(), true
+	case LUA_TNUMINT:
+		return float64(val.integer()), true
+	case LUA_TSTRING:
+		if n, ok := stringToNumber(val.s); ok {
+			return toNumber(n)
+		}
 	}
+	return 0.0, false
 }
 
 func toInteger(val luaValue) (int64, bool) {
-	switch val := val.(type) {
-	case int64:
-		return val, true
-	case float64:
-		return number.FloatToInteger(val)
-	case string:
-		if val, ok := number.ParseInteger(val); ok {
-			return val, ok
-		}
-		if val, ok := number.ParseFloat(val); ok {
-			return number.FloatToInteger(val)
+	switch val.tt {
+	case LUA_TNUMINT:
+		return val.integer(), true
+	case LUA_TNUMFLT:
+		return number.FloatToInteger(val.float())
+	case LUA_TSTRING:
+		if n, ok := stringToNumber(val.s); ok {
+			return toInteger(n)
 		}
 	}
 	return 0, false
 }
 
+/* numeral s as an integer when it is one that fits, as a float otherwise (luaO_str2num) */
+func stringToNumber(s string) (luaValue, bool) {
+	if i, ok := number.ParseInteger(s); ok {
+		return integerValue(i), true
+	}
+	if f, ok := number.ParseFloat(s); ok {
+		return floatValue(f), true
+	}
+	return luaValue{}, false
+}
+
 func toString(val luaValue) (string, bool) {
-	switch val := val.(type) {
-	case string:
-		return val, true
-	case float64, int64:
-		return fmt.Sprintf("%v", val), true
+	switch val.tt {
+	case LUA_TSTRING:
+		return val.s, true
+	case LUA_TNUMFLT:
+		return number.FloatToString(val.float()), true
+	case LUA_TNUMINT:
+		return number.IntegerToString(val.integer()), true
 	default:
 		return "", false
 	}
 }
 
 func equal(a, b luaValue) bool {
-	switch a := a.(type) {
-	case nil:
-		return b == nil
-	case bool:
-		b, ok := b.(bool)
-		return ok && a == b
-	case string:
-		b, ok := b.(string)
-		return ok && a == b
-	case int64:
-		switch b := b.(type) {
-		case int64:
-			return a == b
-		case float64:
-			return float64(a) == b
-		default:
-			return false
-		}
-	case float64:
-		switch b := b.(type) {
-		case float64:
-			return a == b
-		case int64:
-			return a == float64(b)
-		default:
-			return false
-		}
+	switch {
+	case a.tt == LUA_TNUMINT && b.tt == LUA_TNUMFLT:
+		i, ok := number.FloatToInteger(b.float())
+		return ok && a.integer() == i
+	case a.tt == LUA_TNUMFLT && b.tt == LUA_TNUMINT:
+		i, ok := number.FloatToInteger(a.float())
+		return ok && i == b.integer()
+	case a.tt != b.tt:
+		return false
+	case a.tt == LUA_TNUMFLT:
+		return a.float() == b.float()
+	case a.tt == LUA_TSTRING:
+		return a.s == b.s
 	default:
-		return a == b
+		return a.n == b.n
 	}
 }
 
 func lessThan(L *LuaState, a, b luaValue) bool {
-	switch a := a.(type) {
-	case string:
-		if b, ok := b.(string); ok {
-			return a < b
-		}
-	case int64:
-		switch b := b.(type) {
-		case int64:
-			return a < b
-		case float64:
-			return float64(a) < b
-		}
-	case float64:
-		switch b := b.(type) {
-		case float64:
-			return a < b
-		case int64:
-			return a < float64(b)
-		}
+	switch {
+	case a.tt == LUA_TNUMINT && b.tt == LUA_TNUMINT:
+		return a.integer() < b.integer()
+	case a.tt == LUA_TNUMFLT && b.tt == LUA_TNUMFLT:
+		return a.float() < b.float()
+	case a.tt == LUA_TNUMINT && b.tt == LUA_TNUMFLT:
+		return ltIntFloat(a.integer(), b.float())
+	case a.tt == LUA_TNUMFLT && b.tt == LUA_TNUMINT:
+		return !leIntFloat(b.integer(), a.float()) && !math.IsNaN(a.float())
+	case a.tt == LUA_TSTRING && b.tt == LUA_TSTRING:
+		return a.s < b.s
 	}
 	panic(orderError(L, a, b))
 }
 
 func lessEqual(L *LuaState, a, b luaValue) bool {
-	switch a := a.(type) {
-	case string:
-		if b, ok := b.(string); ok {
-			return a <= b
-		}
-	case int64:
-		switch b := b.(type) {
-		case int64:
-			return a <= b
-		case float64:
-			return float64(a) <= b
-		}
-	case float64:
-		switch b := b.(type) {
-		case float64:
-			return a <= b
-		case int64:
-			return a <= float64(b)
-		}
+	switch {
+	case a.tt == LUA_TNUMINT && b.tt == LUA_TNUMINT:
+		return a.integer() <= b.integer()
+	case a.tt == LUA_TNUMFLT && b.tt == LUA_TNUMFLT:
+		return a.float() <= b.float()
+	case a.tt == LUA_TNUMINT && b.tt == LUA_TNUMFLT:
+		return leIntFloat(a.integer(), b.float())
+	case a.tt == LUA_TNUMFLT && b.tt == LUA_TNUMINT:
+		return !ltIntFloat(b.integer(), a.float()) && !math.IsNaN(a.float())
+	case a.tt == LUA_TSTRING && b.tt == LUA_TSTRING:
+		return a.s <= b.s
 	}
 	panic(orderError(L, a, b))
 }
+
+/* i < f without rounding i to a float (LTintfloat): i < f <=> i < ceil(f) */
+func ltIntFloat(i int64, f float64) bool {
+	if fi, ok := number.FloatToIntegerMode(f, number.F2Iceil); ok {
+		return i < fi
+	}
+	return f > 0 // out of the integer range, or NaN
+}
+
+/* i <= f without rounding i to a float (LEintfloat): i <= f <=> i <= floor(f) */
+func leIntFloat(i int64, f float64) bool {
+	if fi, ok := number.FloatToIntegerMode(f, number.F2Ifloor); ok {
+		return i <= fi
+	}
+	return f > 0 // out of the integer range, or NaN
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"math"
+	"testing"
+)
+
+func TestValues(t *testing.T) {
+	L := NewState()
+	L.PushNil()
+	L.PushBoolean(false)
+	L.PushBoolean(true)
+	L.PushInteger(3)
+	L.PushNumber(3.0)
+	L.PushNumber(math.NaN())
+	L.PushString("3")
+
+	types := []LuaType{LUA_TNIL, LUA_TBOOLEAN, LUA_TBOOLEAN, LUA_TNUMBER, LUA_TNUMBER, LUA_TNUMBER, LUA_TSTRING}
+	for i, want := range types {
+		if got := L.Type(i + 1); got != want {
+			t.Errorf("type of %d: got %s, want %s", i+1, L.TypeName(got), L.TypeName(want))
+		}
+	}
+	if L.ToBoolean(1) || L.ToBoolean(2) || !L.ToBoolean(3) || !L.ToBoolean(4) {
+		t.Errorf("unexpected truth values")
+	}
+	if !L.IsInteger(4) || L.IsInteger(5) || L.IsInteger(7) || L.ToInteger(7) != 3 {
+		t.Errorf("unexpected integer conversions")
+	}
+	if !L.Compare(4, 5, LUA_OPEQ) || L.Compare(4, 7, LUA_OPEQ) || L.Compare(6, 6, LUA_OPEQ) ||
+		!L.Compare(1, 1, LUA_OPEQ) || L.Compare(1, 2, LUA_OPEQ) || L.Compare(2, 3, LUA_OPEQ) {
+		t.Errorf("unexpected equalities")
+	}
+	if L.Compare(4, 5, LUA_OPLT) || !L.Compare(4, 5, LUA_OPLE) || L.Compare(4, 6, LUA_OPLE) {
+		t.Errorf("unexpected order")
+	}
+
+	L.Pop(L.GetTop())
+	if L.GetTop() != 0 {
+		t.Errorf("stack not emptied")
+	}
+}
@@ -0,0 +1,78 @@
+package binary
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/uganh16/luago/vm"
+)
+
+/* a function with n instructions and constants, and debug information for them */
+func benchProto(n int) *Prototype {
+	p := &Prototype{Source: "@bench.lua", MaxStackSize: 2}
+	for i := 0; i < n; i++ {
+		p.Code = append(p.Code, vm.CreateABx(vm.OP_LOADK, 0, i))
+		p.LineInfo = append(p.LineInfo, uint32(i+1))
+		switch i % 3 {
+		case 0:
+			p.Constants = append(p.Constants, int64(i))
+		case 1:
+			p.Constants = append(p.Constants, float64(i)/2)
+		default:
+			p.Constants = append(p.Constants, fmt.Sprintf("constant %d", i))
+		}
+	}
+	p.Code = append(p.Code, vm.CreateABC(vm.OP_RETURN, 0, 1, 0))
+	p.LineInfo = append(p.LineInfo, uint32(n+1))
+	p.LocVars = []LocVar{{"x", 1, uint32(n + 1)}}
+	return p
+}
+
+func benchmarkUndump(b *testing.B, p *Prototype, strings func() Interner) {
+	f, err := os.Open(dumpToFile(b, p))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil {
+		b.SetBytes(info.Size())
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Seek(0, 0)
+		if _, err := UndumpInterned(f, strings()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func noInterning() Interner {
+	return nil
+}
+
+func interning() Interner {
+	return StringTable{}
+}
+
+func BenchmarkUndumpSmall(b *testing.B) {
+	benchmarkUndump(b, benchProto(8), noInterning)
+}
+
+/* 100 nested functions of 1000 instructions each */
+func BenchmarkUndumpLarge(b *testing.B) {
+	p := benchProto(10)
+	for i := 0; i < 100; i++ {
+		p.Protos = append(p.Protos, benchProto(1000))
+	}
+	benchmarkUndump(b, p, noInterning)
+}
+
+func BenchmarkUndumpLargeInterned(b *testing.B) {
+	p := benchProto(10)
+	for i := 0; i < 100; i++ {
+		p.Protos = append(p.Protos, benchProto(1000))
+	}
+	benchmarkUndump(b, p, interning)
+}
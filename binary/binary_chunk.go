@@ -1,8 +1,9 @@
 package binary
 
 import (
+	"encoding/binary"
 	"fmt"
-	"os"
+	"io"
 
 	"github.com/uganh16/luago/vm"
 )
@@ -70,7 +71,15 @@ type LocVar struct {
 
 type bailout string
 
-func Undump(file *os.File) (proto *Prototype, err error) {
+func Undump(in io.Reader) (proto *Prototype, err error) {
+	return UndumpInterned(in, nil)
+}
+
+/*
+ * load a chunk like Undump, sharing every string it reads with the equal
+ * string interner has seen before, in this chunk or in earlier ones.
+ */
+func UndumpInterned(in io.Reader, interner Interner) (proto *Prototype, err error) {
 	defer func() {
 		switch x := recover().(type) {
 		case nil:
@@ -82,9 +91,28 @@ func Undump(file *os.File) (proto *Prototype, err error) {
 		}
 	}()
 
-	r := &reader{file}
+	r := &reader{in, interner}
 	order := r.checkHeader()
 	r.readByte() // size_upvalues
 	proto = r.readProto(order, "")
 	return
 }
+
+func Dump(w io.Writer, proto *Prototype, strip bool) (err error) {
+	defer func() {
+		switch x := recover().(type) {
+		case nil:
+			// no panic
+		case bailout:
+			err = fmt.Errorf("%s precompiled chunk", x)
+		default:
+			panic(x)
+		}
+	}()
+
+	d := &writer{w: w, order: binary.LittleEndian, strip: strip}
+	d.writeHeader()
+	d.writeByte(byte(len(proto.Upvalues))) // size_upvalues
+	d.writeProto(proto, "")
+	return d.err
+}
@@ -0,0 +1,62 @@
+package binary
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/uganh16/luago/number"
+)
+
+/* a constant as luac lists it */
+func ConstantString(k interface{}) string {
+	switch k := k.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return fmt.Sprintf("%t", k)
+	case int64:
+		return number.IntegerToString(k)
+	case float64:
+		return number.FloatToString(k)
+	case string:
+		return QuoteString(k)
+	default:
+		return "?"
+	}
+}
+
+/* quote a string the way luac's PrintString does; the result is also a valid Lua literal */
+func QuoteString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			sb.WriteString("\\\"")
+		case '\\':
+			sb.WriteString("\\\\")
+		case '\a':
+			sb.WriteString("\\a")
+		case '\b':
+			sb.WriteString("\\b")
+		case '\f':
+			sb.WriteString("\\f")
+		case '\n':
+			sb.WriteString("\\n")
+		case '\r':
+			sb.WriteString("\\r")
+		case '\t':
+			sb.WriteString("\\t")
+		case '\v':
+			sb.WriteString("\\v")
+		default:
+			if c >= 0x20 && c < 0x7f {
+				sb.WriteByte(c)
+			} else {
+				fmt.Fprintf(&sb, "\\%03d", c)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
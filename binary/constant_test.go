@@ -0,0 +1,29 @@
+package binary
+
+import (
+	"math"
+	"testing"
+)
+
+func TestConstantString(t *testing.T) {
+	tests := []struct {
+		k    interface{}
+		want string
+	}{
+		{nil, "nil"},
+		{true, "true"},
+		{int64(math.MinInt64), "-9223372036854775808"},
+		{1.0, "1.0"},
+		{0.1, "0.1"},
+		{1e15, "1e+15"},
+		{math.Copysign(0, -1), "-0.0"},
+		{math.Inf(1), "inf"},
+		{"a\"b\\c\n", `"a\"b\\c\n"`},
+		{"\x00" + "1\xff", `"\0001\255"`},
+	}
+	for _, test := range tests {
+		if got := ConstantString(test.k); got != test.want {
+			t.Errorf("ConstantString(%#v) = %s, want %s", test.k, got, test.want)
+		}
+	}
+}
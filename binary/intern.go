@@ -0,0 +1,17 @@
+package binary
+
+/* maps each string to a single shared copy of it */
+type Interner interface {
+	Intern(s string) string
+}
+
+/* Interner for chunks loaded outside of a LuaState */
+type StringTable map[string]string
+
+func (t StringTable) Intern(s string) string {
+	if shared, ok := t[s]; ok {
+		return shared
+	}
+	t[s] = s
+	return s
+}
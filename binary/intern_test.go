@@ -0,0 +1,75 @@
+package binary
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"unsafe"
+
+	"github.com/uganh16/luago/vm"
+)
+
+/* the bytes of s, read from the string header as unsafe.StringData (Go 1.20) does */
+func stringData(s string) unsafe.Pointer {
+	return *(*unsafe.Pointer)(unsafe.Pointer(&s))
+}
+
+func dumpToFile(t testing.TB, p *Prototype) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "f.luac")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := Dump(f, p, false); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func undumpFile(t *testing.T, name string, interner Interner) *Prototype {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p, err := UndumpInterned(f, interner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestUndumpInterned(t *testing.T) {
+	ret := vm.CreateABC(vm.OP_RETURN, 0, 1, 0)
+	inner := &Prototype{Code: []vm.Instruction{ret}, Constants: []interface{}{"print", int64(1)}}
+	p := &Prototype{Source: "@f.lua", Code: []vm.Instruction{ret}, Constants: []interface{}{"print", "x"},
+		Protos: []*Prototype{inner}}
+	name := dumpToFile(t, p)
+
+	plain := undumpFile(t, name, nil)
+	if stringData(plain.Constants[0].(string)) == stringData(plain.Protos[0].Constants[0].(string)) {
+		t.Errorf("strings shared without an interner")
+	}
+
+	interner := StringTable{}
+	q := undumpFile(t, name, interner)
+	r := undumpFile(t, name, interner)
+	if !reflect.DeepEqual(q.Constants, p.Constants) || !reflect.DeepEqual(q.Protos[0].Constants, inner.Constants) {
+		t.Fatalf("unexpected constants after round trip: %v %v", q.Constants, q.Protos[0].Constants)
+	}
+	print := stringData(q.Constants[0].(string))
+	for _, s := range []string{q.Protos[0].Constants[0].(string), r.Constants[0].(string), r.Protos[0].Constants[0].(string)} {
+		if stringData(s) != print {
+			t.Errorf("equal strings not shared")
+		}
+	}
+	for _, s := range []string{"@f.lua", "print", "x"} {
+		if _, ok := interner[s]; !ok {
+			t.Errorf("%q not interned", s)
+		}
+	}
+}
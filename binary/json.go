@@ -0,0 +1,176 @@
+package binary
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"unicode/utf8"
+
+	"github.com/uganh16/luago/vm"
+)
+
+/* decoded view of a Prototype, suitable for encoding/json */
+type FunctionInfo struct {
+	Source          string            `json:"source,omitempty"`
+	LineDefined     uint32            `json:"linedefined"`
+	LastLineDefined uint32            `json:"lastlinedefined"`
+	NumParams       byte              `json:"numparams"`
+	IsVararg        bool              `json:"isvararg"`
+	MaxStackSize    byte              `json:"maxstacksize"`
+	Code            []InstructionInfo `json:"code"`
+	Constants       []ConstantInfo    `json:"constants"`
+	Upvalues        []UpvalueInfo     `json:"upvalues"`
+	LocVars         []LocVarInfo      `json:"locvars"`
+	Protos          []*FunctionInfo   `json:"functions"`
+}
+
+type InstructionInfo struct {
+	PC   int           `json:"pc"` // 1-based, as in listings
+	Line uint32        `json:"line,omitempty"`
+	Op   string        `json:"op"`
+	Mode string        `json:"mode"`
+	A    *int          `json:"a,omitempty"`
+	B    *int          `json:"b,omitempty"`
+	C    *int          `json:"c,omitempty"`
+	Bx   *int          `json:"bx,omitempty"`
+	SBx  *int          `json:"sbx,omitempty"`
+	Ax   *int          `json:"ax,omitempty"`
+	KB   *ConstantInfo `json:"kb,omitempty"` // constant referenced by B
+	KC   *ConstantInfo `json:"kc,omitempty"` // constant referenced by C
+	K    *ConstantInfo `json:"k,omitempty"`  // constant referenced by Bx or Ax
+}
+
+type ConstantInfo struct {
+	Type     string      `json:"type"`
+	Value    interface{} `json:"value"`
+	Encoding string      `json:"encoding,omitempty"` // "base64" for strings that are not valid UTF-8
+}
+
+type UpvalueInfo struct {
+	Name    string `json:"name,omitempty"`
+	InStack bool   `json:"instack"`
+	Idx     byte   `json:"idx"`
+}
+
+type LocVarInfo struct {
+	Name    string `json:"name"`
+	StartPC uint32 `json:"startpc"`
+	EndPC   uint32 `json:"endpc"`
+}
+
+var opModeNames = [...]string{"iABC", "iABx", "iAsBx", "iAx"}
+
+func Describe(p *Prototype) *FunctionInfo {
+	f := &FunctionInfo{
+		Source:          p.Source,
+		LineDefined:     p.LineDefined,
+		LastLineDefined: p.LastLineDefined,
+		NumParams:       p.NumParams,
+		IsVararg:        p.IsVararg,
+		MaxStackSize:    p.MaxStackSize,
+		Code:            make([]InstructionInfo, len(p.Code)),
+		Constants:       make([]ConstantInfo, len(p.Constants)),
+		Upvalues:        make([]UpvalueInfo, len(p.Upvalues)),
+		LocVars:         make([]LocVarInfo, len(p.LocVars)),
+		Protos:          make([]*FunctionInfo, len(p.Protos)),
+	}
+	for pc := range p.Code {
+		f.Code[pc] = describeInstruction(p, pc)
+	}
+	for i, k := range p.Constants {
+		f.Constants[i] = describeConstant(k)
+	}
+	for i, upvalue := range p.Upvalues {
+		f.Upvalues[i] = UpvalueInfo{InStack: upvalue.InStack != 0, Idx: upvalue.Idx}
+		if i < len(p.UpvalueNames) {
+			f.Upvalues[i].Name = p.UpvalueNames[i]
+		}
+	}
+	for i, locVar := range p.LocVars {
+		f.LocVars[i] = LocVarInfo{locVar.VarName, locVar.StartPC, locVar.EndPC}
+	}
+	for i, proto := range p.Protos {
+		f.Protos[i] = Describe(proto)
+	}
+	return f
+}
+
+func describeInstruction(p *Prototype, pc int) InstructionInfo {
+	i := p.Code[pc]
+	info := InstructionInfo{PC: pc + 1, Op: i.OpName(), Mode: opModeNames[i.OpMode()]}
+	if pc < len(p.LineInfo) {
+		info.Line = p.LineInfo[pc]
+	}
+	constant := func(idx int) *ConstantInfo {
+		if idx < len(p.Constants) {
+			k := describeConstant(p.Constants[idx])
+			return &k
+		}
+		return nil
+	}
+	switch i.OpMode() {
+	case vm.IABC:
+		a, b, c := i.ABC()
+		info.A = &a
+		if i.BMode() != vm.OpArgN {
+			info.B = &b
+			if i.BMode() == vm.OpArgK && b > 0xff {
+				info.KB = constant(b & 0xff)
+			}
+		}
+		if i.CMode() != vm.OpArgN {
+			info.C = &c
+			if i.CMode() == vm.OpArgK && c > 0xff {
+				info.KC = constant(c & 0xff)
+			}
+		}
+	case vm.IABx:
+		a, bx := i.ABx()
+		info.A = &a
+		info.Bx = &bx
+		if i.BMode() == vm.OpArgK {
+			info.K = constant(bx)
+		}
+	case vm.IAsBx:
+		a, sbx := i.AsBx()
+		info.A = &a
+		info.SBx = &sbx
+	case vm.IAx:
+		ax := i.Ax()
+		info.Ax = &ax
+		if pc > 0 && p.Code[pc-1].Opcode() == vm.OP_LOADKX {
+			info.K = constant(ax)
+		}
+	}
+	return info
+}
+
+func describeConstant(k interface{}) ConstantInfo {
+	switch k := k.(type) {
+	case nil:
+		return ConstantInfo{Type: "nil"}
+	case bool:
+		return ConstantInfo{Type: "boolean", Value: k}
+	case int64:
+		return ConstantInfo{Type: "integer", Value: k}
+	case float64:
+		if math.IsInf(k, 0) || math.IsNaN(k) { // not representable in JSON
+			return ConstantInfo{Type: "float", Value: fmt.Sprintf("%v", k)}
+		}
+		return ConstantInfo{Type: "float", Value: k}
+	case string:
+		if !utf8.ValidString(k) { // encoding/json would replace the invalid bytes
+			return ConstantInfo{Type: "string", Value: []byte(k), Encoding: "base64"}
+		}
+		return ConstantInfo{Type: "string", Value: k}
+	default:
+		return ConstantInfo{Type: "?"}
+	}
+}
+
+func EncodeJSON(w io.Writer, p *Prototype) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(Describe(p))
+}
@@ -0,0 +1,80 @@
+package binary
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/uganh16/luago/vm"
+)
+
+func TestEncodeJSON(t *testing.T) {
+	// stripped: no source, line info or names
+	inner := &Prototype{MaxStackSize: 2, Upvalues: []Upvalue{{0, 0}},
+		Code: []vm.Instruction{
+			vm.CreateABx(vm.OP_LOADK, 0, 0),
+			vm.CreateABC(vm.OP_RETURN, 0, 2, 0),
+		},
+		Constants: []interface{}{math.Copysign(0, -1)},
+	}
+	p := &Prototype{Source: "@t.lua", IsVararg: true, MaxStackSize: 2,
+		Code: []vm.Instruction{
+			vm.CreateABC(vm.OP_EQ, 1, 0x100|4, 0x100|5),
+			vm.CreateAsBx(vm.OP_JMP, 0, 1),
+			vm.CreateABx(vm.OP_CLOSURE, 0, 0),
+			vm.CreateABx(vm.OP_LOADKX, 1, 0),
+			vm.CreateAx(vm.OP_EXTRAARG, 6),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		Constants:    []interface{}{nil, true, int64(-3), 1.5, math.Inf(1), "hi", "\xff\xfe"},
+		LineInfo:     []uint32{1, 1, 2, 3, 3, 3},
+		LocVars:      []LocVar{{"f", 3, 6}},
+		Upvalues:     []Upvalue{{1, 0}},
+		UpvalueNames: []string{"_ENV"},
+		Protos:       []*Prototype{inner},
+	}
+
+	want := `{"source":"@t.lua","linedefined":0,"lastlinedefined":0,"numparams":0,"isvararg":true,"maxstacksize":2,
+	"code":[
+		{"pc":1,"line":1,"op":"EQ","mode":"iABC","a":1,"b":260,"c":261,
+			"kb":{"type":"float","value":"+Inf"},"kc":{"type":"string","value":"hi"}},
+		{"pc":2,"line":1,"op":"JMP","mode":"iAsBx","a":0,"sbx":1},
+		{"pc":3,"line":2,"op":"CLOSURE","mode":"iABx","a":0,"bx":0},
+		{"pc":4,"line":3,"op":"LOADKX","mode":"iABx","a":1,"bx":0},
+		{"pc":5,"line":3,"op":"EXTRAARG","mode":"iAx","ax":6,"k":{"type":"string","value":"//4=","encoding":"base64"}},
+		{"pc":6,"line":3,"op":"RETURN","mode":"iABC","a":0,"b":1}],
+	"constants":[
+		{"type":"nil","value":null},
+		{"type":"boolean","value":true},
+		{"type":"integer","value":-3},
+		{"type":"float","value":1.5},
+		{"type":"float","value":"+Inf"},
+		{"type":"string","value":"hi"},
+		{"type":"string","value":"//4=","encoding":"base64"}],
+	"upvalues":[{"name":"_ENV","instack":true,"idx":0}],
+	"locvars":[{"name":"f","startpc":3,"endpc":6}],
+	"functions":[{"linedefined":0,"lastlinedefined":0,"numparams":0,"isvararg":false,"maxstacksize":2,
+		"code":[
+			{"pc":1,"op":"LOADK","mode":"iABx","a":0,"bx":0,"k":{"type":"float","value":-0}},
+			{"pc":2,"op":"RETURN","mode":"iABC","a":0,"b":2}],
+		"constants":[{"type":"float","value":-0}],
+		"upvalues":[{"instack":false,"idx":0}],
+		"locvars":[],
+		"functions":[]}]}`
+
+	var got, expected bytes.Buffer
+	var out bytes.Buffer
+	if err := EncodeJSON(&out, p); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Compact(&got, out.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Compact(&expected, []byte(want)); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != expected.String() {
+		t.Errorf("got\n%s\nwant\n%s", got.String(), expected.String())
+	}
+}
@@ -3,15 +3,16 @@ package binary
 import (
 	"encoding/binary"
 	"fmt"
+	"io"
 	"math"
-	"os"
 
 	"github.com/uganh16/luago/api"
 	"github.com/uganh16/luago/vm"
 )
 
 type reader struct {
-	file *os.File
+	in       io.Reader
+	interner Interner // nil if strings are not interned
 }
 
 func (r *reader) checkHeader() binary.ByteOrder {
@@ -177,7 +178,11 @@ func (r *reader) readString(order binary.ByteOrder) string {
 	if n == 0xff { // long string
 		n = uint(r.readUint64(order))
 	}
-	return string(r.readBytes(n - 1))
+	s := string(r.readBytes(n - 1))
+	if r.interner != nil {
+		s = r.interner.Intern(s)
+	}
+	return s
 }
 
 func (r *reader) readByte() byte {
@@ -186,9 +191,8 @@ func (r *reader) readByte() byte {
 
 func (r *reader) readBytes(n uint) []byte {
 	b := make([]byte, n)
-	_, err := r.file.Read(b)
-	if err != nil {
-		panicF("truncated precompiled chunk")
+	if _, err := io.ReadFull(r.in, b); err != nil {
+		panicF("truncated")
 	}
 	return b
 }
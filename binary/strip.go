@@ -0,0 +1,29 @@
+package binary
+
+/* parts of the debug information removed by Strip */
+const (
+	STRIP_SOURCE       = 1 << iota // source names
+	STRIP_LINEINFO                 // line numbers of instructions
+	STRIP_LOCVARS                  // names and scopes of local variables
+	STRIP_UPVALUENAMES             // names of upvalues
+	STRIP_ALL          = STRIP_SOURCE | STRIP_LINEINFO | STRIP_LOCVARS | STRIP_UPVALUENAMES
+)
+
+/* remove the parts of the debug information in what from p and its nested functions */
+func Strip(p *Prototype, what int) {
+	if what&STRIP_SOURCE != 0 {
+		p.Source = ""
+	}
+	if what&STRIP_LINEINFO != 0 {
+		p.LineInfo = nil
+	}
+	if what&STRIP_LOCVARS != 0 {
+		p.LocVars = nil
+	}
+	if what&STRIP_UPVALUENAMES != 0 {
+		p.UpvalueNames = nil
+	}
+	for _, proto := range p.Protos {
+		Strip(proto, what)
+	}
+}
@@ -0,0 +1,47 @@
+package binary
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/uganh16/luago/vm"
+)
+
+func TestStrip(t *testing.T) {
+	ret := vm.CreateABC(vm.OP_RETURN, 0, 1, 0)
+	inner := &Prototype{Source: "@f.lua", Code: []vm.Instruction{ret}, LineInfo: []uint32{2},
+		Upvalues: []Upvalue{{1, 0}}, UpvalueNames: []string{"x"}}
+	p := &Prototype{Source: "@f.lua", IsVararg: true, MaxStackSize: 2, Code: []vm.Instruction{ret}, LineInfo: []uint32{1},
+		LocVars: []LocVar{{"x", 0, 1}}, Upvalues: []Upvalue{{1, 0}}, Protos: []*Prototype{inner}, UpvalueNames: []string{"_ENV"}}
+
+	Strip(p, STRIP_LOCVARS|STRIP_UPVALUENAMES)
+	if p.LocVars != nil || p.UpvalueNames != nil || inner.UpvalueNames != nil {
+		t.Errorf("names not stripped")
+	}
+	if p.Source != "@f.lua" || len(p.LineInfo) != 1 || len(inner.LineInfo) != 1 {
+		t.Errorf("source or line info stripped")
+	}
+
+	name := filepath.Join(t.TempDir(), "f.luac")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Dump(f, p, false); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if f, err = os.Open(name); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	q, err := Undump(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Source != "@f.lua" || len(q.LineInfo) != 1 || len(q.LocVars) != 0 || len(q.Protos) != 1 ||
+		q.Protos[0].LineInfo[0] != 2 || len(q.Protos[0].UpvalueNames) != 0 {
+		t.Errorf("unexpected chunk after round trip: %+v", q)
+	}
+}
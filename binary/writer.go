@@ -0,0 +1,182 @@
+package binary
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/uganh16/luago/api"
+)
+
+/* maximum length for short strings, that is, strings that are internalized */
+const LUAI_MAXSHORTLEN = 40
+
+type writer struct {
+	w     io.Writer
+	order binary.ByteOrder
+	strip bool
+	err   error
+}
+
+func (w *writer) writeHeader() {
+	w.writeLiteral(LUA_SIGNATURE)
+	w.writeByte(LUAC_VERSION)
+	w.writeByte(LUAC_FORMAT)
+	w.writeLiteral(LUAC_DATA)
+	w.writeByte(CINT_SIZE)
+	w.writeByte(CSIZET_SIZE)
+	w.writeByte(INSTRUCTION_SIZE)
+	w.writeByte(LUA_INTEGER_SIZE)
+	w.writeByte(LUA_NUMBER_SIZE)
+	w.writeLuaInteger(LUAC_INT)
+	w.writeLuaNumber(LUAC_NUM)
+}
+
+func (w *writer) writeProto(p *Prototype, parentSource string) {
+	if w.strip || p.Source == parentSource {
+		w.writeString("", false)
+	} else {
+		w.writeString(p.Source, true)
+	}
+	w.writeUint32(p.LineDefined)
+	w.writeUint32(p.LastLineDefined)
+	w.writeByte(p.NumParams)
+	if p.IsVararg {
+		w.writeByte(1)
+	} else {
+		w.writeByte(0)
+	}
+	w.writeByte(p.MaxStackSize)
+	w.writeCode(p)
+	w.writeConstants(p)
+	w.writeUpvalues(p)
+	w.writeProtos(p)
+	w.writeDebug(p)
+}
+
+func (w *writer) writeCode(p *Prototype) {
+	w.writeUint32(uint32(len(p.Code)))
+	for _, i := range p.Code {
+		w.writeUint32(uint32(i))
+	}
+}
+
+func (w *writer) writeConstants(p *Prototype) {
+	w.writeUint32(uint32(len(p.Constants)))
+	for _, k := range p.Constants {
+		switch k := k.(type) {
+		case nil:
+			w.writeByte(api.LUA_TNIL)
+		case bool:
+			w.writeByte(api.LUA_TBOOLEAN)
+			if k {
+				w.writeByte(1)
+			} else {
+				w.writeByte(0)
+			}
+		case float64:
+			w.writeByte(api.LUA_TNUMFLT)
+			w.writeLuaNumber(k)
+		case int64:
+			w.writeByte(api.LUA_TNUMINT)
+			w.writeLuaInteger(k)
+		case string:
+			if len(k) <= LUAI_MAXSHORTLEN {
+				w.writeByte(api.LUA_TSHRSTR)
+			} else {
+				w.writeByte(api.LUA_TLNGSTR)
+			}
+			w.writeString(k, true)
+		default:
+			panicF("invalid constant type %T in", k)
+		}
+	}
+}
+
+func (w *writer) writeUpvalues(p *Prototype) {
+	w.writeUint32(uint32(len(p.Upvalues)))
+	for _, upvalue := range p.Upvalues {
+		w.writeByte(upvalue.InStack)
+		w.writeByte(upvalue.Idx)
+	}
+}
+
+func (w *writer) writeProtos(p *Prototype) {
+	w.writeUint32(uint32(len(p.Protos)))
+	for _, proto := range p.Protos {
+		w.writeProto(proto, p.Source)
+	}
+}
+
+func (w *writer) writeDebug(p *Prototype) {
+	if w.strip {
+		w.writeUint32(0) // line info
+		w.writeUint32(0) // local variables
+		w.writeUint32(0) // upvalue names
+		return
+	}
+	w.writeUint32(uint32(len(p.LineInfo)))
+	for _, line := range p.LineInfo {
+		w.writeUint32(line)
+	}
+	w.writeUint32(uint32(len(p.LocVars)))
+	for _, locVar := range p.LocVars {
+		w.writeString(locVar.VarName, true)
+		w.writeUint32(locVar.StartPC)
+		w.writeUint32(locVar.EndPC)
+	}
+	w.writeUint32(uint32(len(p.UpvalueNames)))
+	for _, name := range p.UpvalueNames {
+		w.writeString(name, true)
+	}
+}
+
+func (w *writer) writeLuaInteger(i int64) {
+	w.writeUint64(uint64(i))
+}
+
+func (w *writer) writeLuaNumber(n float64) {
+	w.writeUint64(math.Float64bits(n))
+}
+
+func (w *writer) writeUint32(i uint32) {
+	b := make([]byte, 4)
+	w.order.PutUint32(b, i)
+	w.writeBytes(b)
+}
+
+func (w *writer) writeUint64(i uint64) {
+	b := make([]byte, 8)
+	w.order.PutUint64(b, i)
+	w.writeBytes(b)
+}
+
+/* a string that is not present (NULL in C Lua) is dumped as size 0 */
+func (w *writer) writeString(s string, present bool) {
+	if !present {
+		w.writeByte(0)
+		return
+	}
+	n := uint64(len(s)) + 1 // include trailing '\0'
+	if n < 0xff {
+		w.writeByte(byte(n))
+	} else {
+		w.writeByte(0xff)
+		w.writeUint64(n)
+	}
+	w.writeLiteral(s)
+}
+
+func (w *writer) writeLiteral(s string) {
+	w.writeBytes([]byte(s))
+}
+
+func (w *writer) writeByte(b byte) {
+	w.writeBytes([]byte{b})
+}
+
+func (w *writer) writeBytes(b []byte) {
+	if w.err == nil {
+		_, w.err = w.w.Write(b)
+	}
+}
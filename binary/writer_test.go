@@ -0,0 +1,42 @@
+package binary
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/uganh16/luago/vm"
+)
+
+func TestDump(t *testing.T) {
+	inner := &Prototype{Source: "@f.lua", LineDefined: 2, LastLineDefined: 4, NumParams: 1, MaxStackSize: 2,
+		Code:         []vm.Instruction{vm.CreateABC(vm.OP_GETUPVAL, 1, 0, 0), vm.CreateABC(vm.OP_RETURN, 1, 2, 0)},
+		Constants:    []interface{}{},
+		Upvalues:     []Upvalue{{0, 0}},
+		Protos:       []*Prototype{},
+		LineInfo:     []uint32{3, 3},
+		LocVars:      []LocVar{{"a", 0, 2}},
+		UpvalueNames: []string{"x"},
+	}
+	p := &Prototype{Source: "@f.lua", IsVararg: true, MaxStackSize: 2,
+		Code: []vm.Instruction{
+			vm.CreateABx(vm.OP_LOADK, 0, 0),
+			vm.CreateABx(vm.OP_CLOSURE, 1, 0),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		Constants:    []interface{}{nil, true, false, int64(math.MinInt64), math.Copysign(0, -1), math.Inf(-1), "", "x\x00y"},
+		Upvalues:     []Upvalue{{1, 0}},
+		Protos:       []*Prototype{inner},
+		LineInfo:     []uint32{1, 4, 5},
+		LocVars:      []LocVar{{"x", 1, 3}},
+		UpvalueNames: []string{"_ENV"},
+	}
+
+	q := undumpFile(t, dumpToFile(t, p), nil)
+	if !reflect.DeepEqual(q, p) {
+		t.Errorf("round trip changed the chunk:\ngot  %+v\nwant %+v", q, p)
+	}
+	if !math.Signbit(q.Constants[4].(float64)) {
+		t.Errorf("round trip lost the sign of -0.0")
+	}
+}
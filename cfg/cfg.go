@@ -0,0 +1,252 @@
+package cfg
+
+import (
+	"sort"
+
+	"github.com/uganh16/luago/binary"
+	"github.com/uganh16/luago/vm"
+)
+
+/* a maximal straight-line run of instructions, Code[Start:End] */
+type Block struct {
+	Index int
+	Start int
+	End   int
+	Succs []*Block
+	Preds []*Block
+	IDom  *Block // immediate dominator; nil for the entry and unreachable blocks
+	order int    // reverse postorder number, -1 if unreachable
+}
+
+type Graph struct {
+	Proto  *binary.Prototype
+	Blocks []*Block // in pc order; Blocks[0] is the entry
+	blocks []*Block // block of each pc
+}
+
+/* natural loop: a header and every block that reaches a back edge to it */
+type Loop struct {
+	Header *Block
+	Blocks []*Block // in pc order, header included
+}
+
+func Build(p *binary.Prototype) *Graph {
+	g := &Graph{Proto: p, blocks: make([]*Block, len(p.Code))}
+	if len(p.Code) == 0 {
+		return g
+	}
+
+	leaders := make([]bool, len(p.Code)+1)
+	leaders[0] = true
+	for pc := range p.Code {
+		targets, ends := successors(p, pc)
+		if ends {
+			leaders[pc+1] = true
+			for _, target := range targets {
+				leaders[target] = true
+			}
+		}
+	}
+
+	for pc := range p.Code {
+		if leaders[pc] {
+			g.Blocks = append(g.Blocks, &Block{Index: len(g.Blocks), Start: pc})
+		}
+		b := g.Blocks[len(g.Blocks)-1]
+		b.End = pc + 1
+		g.blocks[pc] = b
+	}
+
+	for _, b := range g.Blocks {
+		targets, _ := successors(p, b.End-1)
+		for _, target := range targets {
+			if target < len(p.Code) {
+				g.addEdge(b, g.blocks[target])
+			}
+		}
+	}
+
+	g.computeDominators()
+	return g
+}
+
+/* pcs control may reach after executing pc, and whether pc ends a block */
+func successors(p *binary.Prototype, pc int) (targets []int, ends bool) {
+	i := p.Code[pc]
+	switch i.Opcode() {
+	case vm.OP_JMP:
+		_, sbx := i.AsBx()
+		return []int{clamp(p, pc+1+sbx)}, true
+	case vm.OP_FORPREP:
+		_, sbx := i.AsBx()
+		return []int{clamp(p, pc+1+sbx)}, true
+	case vm.OP_FORLOOP, vm.OP_TFORLOOP:
+		_, sbx := i.AsBx()
+		return []int{clamp(p, pc+1+sbx), pc + 1}, true
+	case vm.OP_LOADBOOL:
+		if _, _, c := i.ABC(); c != 0 {
+			return []int{clamp(p, pc+2)}, true
+		}
+	case vm.OP_RETURN:
+		return nil, true
+	case vm.OP_TAILCALL:
+		return []int{pc + 1}, true // falls into RETURN when calling a Go function
+	default:
+		if i.TestFlag() { // next instruction is a jump
+			return []int{pc + 1, clamp(p, pc+2)}, true
+		}
+	}
+	return []int{pc + 1}, false
+}
+
+func clamp(p *binary.Prototype, pc int) int {
+	if pc < 0 || pc > len(p.Code) {
+		return len(p.Code)
+	}
+	return pc
+}
+
+func (g *Graph) addEdge(from, to *Block) {
+	for _, b := range from.Succs {
+		if b == to {
+			return
+		}
+	}
+	from.Succs = append(from.Succs, to)
+	to.Preds = append(to.Preds, from)
+}
+
+/* block containing pc */
+func (g *Graph) BlockAt(pc int) *Block {
+	return g.blocks[pc]
+}
+
+func (b *Block) Reachable() bool {
+	return b.order >= 0
+}
+
+func (g *Graph) Dominates(a, b *Block) bool {
+	if !a.Reachable() || !b.Reachable() {
+		return false
+	}
+	for ; b != nil; b = b.IDom {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
+
+/* Cooper, Harvey and Kennedy, "A Simple, Fast Dominance Algorithm" */
+func (g *Graph) computeDominators() {
+	for _, b := range g.Blocks {
+		b.order = -1
+	}
+	var postorder []*Block
+	visited := make([]bool, len(g.Blocks))
+	var dfs func(b *Block)
+	dfs = func(b *Block) {
+		visited[b.Index] = true
+		for _, s := range b.Succs {
+			if !visited[s.Index] {
+				dfs(s)
+			}
+		}
+		postorder = append(postorder, b)
+	}
+	dfs(g.Blocks[0])
+	rpo := make([]*Block, len(postorder))
+	for i, b := range postorder {
+		rpo[len(postorder)-1-i] = b
+		b.order = len(postorder) - 1 - i
+	}
+
+	entry := g.Blocks[0]
+	doms := make([]*Block, len(g.Blocks))
+	doms[entry.Index] = entry
+	intersect := func(a, b *Block) *Block {
+		for a != b {
+			for a.order > b.order {
+				a = doms[a.Index]
+			}
+			for b.order > a.order {
+				b = doms[b.Index]
+			}
+		}
+		return a
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, b := range rpo[1:] {
+			var idom *Block
+			for _, p := range b.Preds {
+				if doms[p.Index] != nil {
+					if idom == nil {
+						idom = p
+					} else {
+						idom = intersect(p, idom)
+					}
+				}
+			}
+			if doms[b.Index] != idom {
+				doms[b.Index] = idom
+				changed = true
+			}
+		}
+	}
+	for _, b := range rpo[1:] {
+		b.IDom = doms[b.Index]
+	}
+}
+
+func (g *Graph) Loops() []*Loop {
+	var loops []*Loop
+	byHeader := map[*Block]*Loop{}
+	for _, b := range g.Blocks {
+		for _, h := range b.Succs {
+			if !g.Dominates(h, b) { // not a back edge
+				continue
+			}
+			loop := byHeader[h]
+			if loop == nil {
+				loop = &Loop{Header: h, Blocks: []*Block{h}}
+				byHeader[h] = loop
+				loops = append(loops, loop)
+			}
+			loop.addBody(b)
+		}
+	}
+	for _, loop := range loops {
+		sort.Slice(loop.Blocks, func(i, j int) bool {
+			return loop.Blocks[i].Index < loop.Blocks[j].Index
+		})
+	}
+	return loops
+}
+
+/* add latch and every block reaching it without passing the header */
+func (loop *Loop) addBody(latch *Block) {
+	stack := []*Block{latch}
+	for len(stack) > 0 {
+		b := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if loop.Contains(b) {
+			continue
+		}
+		loop.Blocks = append(loop.Blocks, b)
+		for _, p := range b.Preds {
+			if p.Reachable() {
+				stack = append(stack, p)
+			}
+		}
+	}
+}
+
+func (loop *Loop) Contains(b *Block) bool {
+	for _, x := range loop.Blocks {
+		if x == b {
+			return true
+		}
+	}
+	return false
+}
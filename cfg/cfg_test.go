@@ -0,0 +1,102 @@
+package cfg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/uganh16/luago/binary"
+	"github.com/uganh16/luago/vm"
+)
+
+/*
+ * local x = 1
+ * while x < 10 do
+ *   if x == 5 then x = x + 2 else x = x + 1 end
+ * end
+ */
+func whileProto() *binary.Prototype {
+	return &binary.Prototype{
+		MaxStackSize: 2,
+		Code: []vm.Instruction{
+			vm.CreateABx(vm.OP_LOADK, 0, 0),      // 1
+			vm.CreateABC(vm.OP_LT, 0, 0, 0x101),  // 2
+			vm.CreateAsBx(vm.OP_JMP, 0, 6),       // 3 -> 10
+			vm.CreateABC(vm.OP_EQ, 0, 0, 0x102),  // 4
+			vm.CreateAsBx(vm.OP_JMP, 0, 2),       // 5 -> 8
+			vm.CreateABC(vm.OP_ADD, 0, 0, 0x103), // 6
+			vm.CreateAsBx(vm.OP_JMP, 0, 1),       // 7 -> 9
+			vm.CreateABC(vm.OP_ADD, 0, 0, 0x100), // 8
+			vm.CreateAsBx(vm.OP_JMP, 0, -8),      // 9 -> 2
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),  // 10
+		},
+		Constants: []interface{}{int64(1), int64(10), int64(5), int64(2)},
+	}
+}
+
+func TestBuild(t *testing.T) {
+	g := Build(whileProto())
+
+	want := [][2]int{{0, 1}, {1, 2}, {2, 3}, {3, 4}, {4, 5}, {5, 7}, {7, 8}, {8, 9}, {9, 10}}
+	if len(g.Blocks) != len(want) {
+		t.Fatalf("got %d blocks, want %d", len(g.Blocks), len(want))
+	}
+	for i, b := range g.Blocks {
+		if b.Start != want[i][0] || b.End != want[i][1] {
+			t.Errorf("block %d: got [%d,%d), want [%d,%d)", i, b.Start, b.End, want[i][0], want[i][1])
+		}
+	}
+
+	test := g.BlockAt(1)
+	if len(test.Succs) != 2 || test.Succs[0] != g.BlockAt(2) || test.Succs[1] != g.BlockAt(3) {
+		t.Errorf("unexpected successors of the loop test: %v", test.Succs)
+	}
+	if g.BlockAt(9).IDom != g.BlockAt(2) {
+		t.Errorf("RETURN should be dominated by the exit jump")
+	}
+	if !g.Dominates(test, g.BlockAt(8)) || g.Dominates(g.BlockAt(5), g.BlockAt(8)) {
+		t.Errorf("unexpected dominance")
+	}
+
+	loops := g.Loops()
+	if len(loops) != 1 || loops[0].Header != test {
+		t.Fatalf("expected one loop headed by the test, got %v", loops)
+	}
+	if n := len(loops[0].Blocks); n != 6 {
+		t.Errorf("loop has %d blocks, want 6", n)
+	}
+	if loops[0].Contains(g.BlockAt(0)) || loops[0].Contains(g.BlockAt(9)) {
+		t.Errorf("loop contains blocks outside of it")
+	}
+}
+
+func TestForLoop(t *testing.T) {
+	// for i = 1, 3 do end
+	p := &binary.Prototype{
+		MaxStackSize: 4,
+		Code: []vm.Instruction{
+			vm.CreateABx(vm.OP_LOADK, 0, 0),
+			vm.CreateABx(vm.OP_LOADK, 1, 1),
+			vm.CreateABx(vm.OP_LOADK, 2, 0),
+			vm.CreateAsBx(vm.OP_FORPREP, 0, 0),
+			vm.CreateAsBx(vm.OP_FORLOOP, 0, -1),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		Constants: []interface{}{int64(1), int64(3)},
+	}
+	g := Build(p)
+	if len(g.Blocks) != 3 {
+		t.Fatalf("got %d blocks, want 3", len(g.Blocks))
+	}
+	loops := g.Loops()
+	if len(loops) != 1 || loops[0].Header != g.BlockAt(4) || len(loops[0].Blocks) != 1 {
+		t.Errorf("expected FORLOOP to be a self loop")
+	}
+
+	var sb strings.Builder
+	if err := WriteDOT(&sb, p); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sb.String(), "B1 -> B1 [style=bold];") {
+		t.Errorf("back edge missing from DOT output:\n%s", sb.String())
+	}
+}
@@ -0,0 +1,65 @@
+package cfg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/uganh16/luago/binary"
+)
+
+/* write a digraph for p and each nested function, named by their path (main, main/0, ...) */
+func WriteDOT(w io.Writer, p *binary.Prototype) error {
+	bw := bufio.NewWriter(w)
+	writeDOT(bw, p, "main")
+	return bw.Flush()
+}
+
+func writeDOT(w *bufio.Writer, p *binary.Prototype, name string) {
+	Build(p).writeDOT(w, name)
+	for i, proto := range p.Protos {
+		writeDOT(w, proto, fmt.Sprintf("%s/%d", name, i))
+	}
+}
+
+func (g *Graph) WriteDOT(w io.Writer, name string) error {
+	bw := bufio.NewWriter(w)
+	g.writeDOT(bw, name)
+	return bw.Flush()
+}
+
+func (g *Graph) writeDOT(w *bufio.Writer, name string) {
+	headers := map[*Block]bool{}
+	for _, loop := range g.Loops() {
+		headers[loop.Header] = true
+	}
+
+	fmt.Fprintf(w, "digraph %q {\n", name)
+	fmt.Fprintf(w, "\tnode [shape=box fontname=\"monospace\"];\n")
+	for _, b := range g.Blocks {
+		var label strings.Builder
+		fmt.Fprintf(&label, "B%d [%d-%d]\\l", b.Index, b.Start+1, b.End)
+		for pc := b.Start; pc < b.End; pc++ {
+			fmt.Fprintf(&label, "%d: %s\\l", pc+1, g.Proto.Code[pc])
+		}
+		attrs := ""
+		if headers[b] {
+			attrs += " penwidth=2"
+		}
+		if !b.Reachable() {
+			attrs += " style=dashed"
+		}
+		fmt.Fprintf(w, "\tB%d [label=\"%s\"%s];\n", b.Index, strings.ReplaceAll(label.String(), "\"", "\\\""), attrs)
+	}
+	for _, b := range g.Blocks {
+		for _, s := range b.Succs {
+			if g.Dominates(s, b) {
+				fmt.Fprintf(w, "\tB%d -> B%d [style=bold];\n", b.Index, s.Index) // back edge
+			} else {
+				fmt.Fprintf(w, "\tB%d -> B%d;\n", b.Index, s.Index)
+			}
+		}
+	}
+	fmt.Fprintf(w, "}\n")
+}
@@ -0,0 +1,409 @@
+package conformance
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/uganh16/luago/api"
+	"github.com/uganh16/luago/number"
+)
+
+/*
+ * Run the statements of a Lua test file that need nothing beyond the api
+ * package: assertions, and local or global assignments, over literals,
+ * operators and a few library functions. Everything is evaluated on a
+ * LuaState. Other statements, such as function definitions and loops,
+ * are skipped, as are assertions on the lines in skip.
+ */
+func Run(file string, src []byte, skip map[int]bool) (*Result, error) {
+	toks, err := tokenize(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	r := &Result{File: file}
+	p := &parser{toks: toks}
+	m := &machine{L: api.NewState(), vars: map[string]int{}}
+	var blocks []scope
+	for p.peek().kind != tokEOF {
+		if p.test(";") {
+			continue
+		}
+		if p.test("do") {
+			blocks = append(blocks, m.enter())
+			continue
+		}
+		if len(blocks) > 0 && p.test("end") {
+			m.leave(blocks[len(blocks)-1])
+			blocks = blocks[:len(blocks)-1]
+			continue
+		}
+		start := p.pos
+		s, why := parse(p)
+		if s == nil {
+			p.pos = start
+			p.skipStatement()
+			r.skip(p.toks[start].line, why)
+			continue
+		}
+		if skip[s.line] {
+			r.skip(s.line, "in skip list")
+			continue
+		}
+		switch ok, msg, why := m.run(s); {
+		case why != "":
+			r.skip(s.line, why)
+		case ok:
+			if s.kind == stmtAssert {
+				r.Passed++
+			}
+		case msg == "":
+			r.fail(s.line, "assertion failed!")
+		default:
+			r.fail(s.line, msg)
+		}
+	}
+	return r, nil
+}
+
+/* pass, fail and skip counts of a test file */
+type Result struct {
+	File     string
+	Passed   int // assertions that held
+	Failed   int // assertions and assignments that did not
+	Skipped  int // statements not run
+	Failures []Failure
+	Skips    []Failure
+}
+
+type Failure struct {
+	Line    int
+	Message string
+}
+
+func (r *Result) fail(line int, msg string) {
+	r.Failed++
+	r.Failures = append(r.Failures, Failure{line, msg})
+}
+
+func (r *Result) skip(line int, why string) {
+	r.Skipped++
+	r.Skips = append(r.Skips, Failure{line, why})
+}
+
+func (r *Result) String() string {
+	return fmt.Sprintf("%s: %d passed, %d failed, %d skipped", r.File, r.Passed, r.Failed, r.Skipped)
+}
+
+func parse(p *parser) (s *stmt, why string) {
+	defer func() {
+		switch x := recover().(type) {
+		case nil:
+			// no panic
+		case unsupported:
+			s, why = nil, string(x)
+		default:
+			panic(x)
+		}
+	}()
+	return p.statement(), ""
+}
+
+type machine struct {
+	L    *api.LuaState
+	vars map[string]int // stack slot of each variable
+}
+
+/* variables visible and stack in use when a block was entered */
+type scope struct {
+	vars map[string]int
+	top  int
+}
+
+func (m *machine) enter() scope {
+	vars := map[string]int{}
+	for n, slot := range m.vars {
+		vars[n] = slot
+	}
+	return scope{vars, m.L.GetTop()}
+}
+
+/* drop the locals of a block, keeping what it assigned to outer variables */
+func (m *machine) leave(s scope) {
+	m.vars = s.vars
+	m.L.SetTop(s.top)
+}
+
+/*
+ * run s; return whether it succeeded with the error message if it raised
+ * one, or why it could not be run
+ */
+func (m *machine) run(s *stmt) (ok bool, msg string, why string) {
+	L := m.L
+	base := L.GetTop()
+	defer func() {
+		if x := recover(); x != nil {
+			L.SetTop(base)
+			if reason, isUnsupported := x.(unsupported); isUnsupported {
+				why = string(reason)
+			} else {
+				msg = fmt.Sprint(x)
+			}
+		}
+	}()
+
+	switch s.kind {
+	case stmtAssert:
+		m.eval(s.exprs[0])
+		ok = L.ToBoolean(-1)
+		if !ok && len(s.exprs) > 1 {
+			m.eval(s.exprs[1])
+			msg = L.ToString(-1)
+		}
+		L.SetTop(base)
+		return ok, msg, ""
+	default:
+		for i, e := range s.exprs {
+			m.eval(e)
+			if i >= len(s.names) {
+				L.Pop(1)
+			}
+		}
+		for i := len(s.exprs); i < len(s.names); i++ {
+			L.PushNil()
+		}
+		top := base
+		for i, n := range s.names {
+			value := base + 1 + i
+			if slot, ok := m.vars[n]; ok && s.kind == stmtAssign {
+				L.Copy(value, slot)
+			} else {
+				top++
+				L.Copy(value, top)
+				m.vars[n] = top
+			}
+		}
+		L.SetTop(top)
+		return true, "", ""
+	}
+}
+
+var arithOps = map[string]api.ArithOp{
+	"+": api.LUA_OPADD, "-": api.LUA_OPSUB, "*": api.LUA_OPMUL, "%": api.LUA_OPMOD,
+	"^": api.LUA_OPPOW, "/": api.LUA_OPDIV, "//": api.LUA_OPIDIV, "&": api.LUA_OPBAND,
+	"|": api.LUA_OPBOR, "~": api.LUA_OPBXOR, "<<": api.LUA_OPSHL, ">>": api.LUA_OPSHR,
+}
+
+/* push the value of e */
+func (m *machine) eval(e expr) {
+	L := m.L
+	switch e := e.(type) {
+	case *constant:
+		switch v := e.value.(type) {
+		case nil:
+			L.PushNil()
+		case bool:
+			L.PushBoolean(v)
+		case int64:
+			L.PushInteger(v)
+		case float64:
+			L.PushNumber(v)
+		case string:
+			L.PushString(v)
+		}
+	case *name:
+		if slot, ok := m.vars[e.name]; ok {
+			L.PushValue(slot)
+		} else {
+			m.global(e.name)
+		}
+	case *unop:
+		m.eval(e.x)
+		switch e.op {
+		case "-":
+			L.Arith(api.LUA_OPUNM)
+		case "~":
+			L.Arith(api.LUA_OPBNOT)
+		case "not":
+			b := L.ToBoolean(-1)
+			L.Pop(1)
+			L.PushBoolean(!b)
+		case "#":
+			if L.Type(-1) != api.LUA_TSTRING {
+				panic(unsupported("length of a " + L.TypeName(L.Type(-1)) + " value"))
+			}
+			L.Len(-1)
+			L.Remove(-2)
+		}
+	case *binop:
+		m.binop(e)
+	case *call:
+		m.call(e)
+	}
+}
+
+func (m *machine) binop(e *binop) {
+	L := m.L
+	switch e.op {
+	case "and", "or":
+		m.eval(e.x)
+		if L.ToBoolean(-1) == (e.op == "and") {
+			L.Pop(1)
+			m.eval(e.y)
+		}
+		return
+	}
+
+	m.eval(e.x)
+	m.eval(e.y)
+	if op, ok := arithOps[e.op]; ok {
+		L.Arith(op)
+		return
+	}
+	var r bool
+	switch e.op {
+	case "..":
+		L.Concat(2)
+		return
+	case "==":
+		r = L.Compare(-2, -1, api.LUA_OPEQ)
+	case "~=":
+		r = !L.Compare(-2, -1, api.LUA_OPEQ)
+	case "<":
+		r = L.Compare(-2, -1, api.LUA_OPLT)
+	case "<=":
+		r = L.Compare(-2, -1, api.LUA_OPLE)
+	case ">":
+		r = L.Compare(-1, -2, api.LUA_OPLT)
+	case ">=":
+		r = L.Compare(-1, -2, api.LUA_OPLE)
+	}
+	L.Pop(2)
+	L.PushBoolean(r)
+}
+
+/* push a library constant */
+func (m *machine) global(n string) {
+	L := m.L
+	switch n {
+	case "math.huge":
+		L.PushNumber(math.Inf(1))
+	case "math.pi":
+		L.PushNumber(math.Pi)
+	case "math.maxinteger":
+		L.PushInteger(math.MaxInt64)
+	case "math.mininteger":
+		L.PushInteger(math.MinInt64)
+	default:
+		panic(unsupported(fmt.Sprintf("variable '%s'", n)))
+	}
+}
+
+/*
+ * push the result of a library function, or of one of the helpers the
+ * test files define in Lua (eqT, isNaN)
+ */
+func (m *machine) call(e *call) {
+	L := m.L
+	base := L.GetTop()
+	for _, arg := range e.args {
+		m.eval(arg)
+	}
+	nargs := L.GetTop() - base
+	arg := func(i int) int {
+		if i > nargs {
+			panic(fmt.Sprintf("bad argument #%d to '%s' (value expected)", i, e.fn))
+		}
+		return base + i
+	}
+
+	switch e.fn {
+	case "tonumber":
+		if nargs > 1 {
+			panic(unsupported("tonumber with a base"))
+		}
+		switch L.Type(arg(1)) {
+		case api.LUA_TNUMBER:
+			L.PushValue(arg(1))
+		case api.LUA_TSTRING:
+			if !L.StringToNumber(L.ToString(arg(1))) {
+				L.PushNil()
+			}
+		default:
+			L.PushNil()
+		}
+	case "tostring":
+		switch L.Type(arg(1)) {
+		case api.LUA_TNIL:
+			L.PushString("nil")
+		case api.LUA_TBOOLEAN:
+			L.PushString(fmt.Sprint(L.ToBoolean(arg(1))))
+		case api.LUA_TNUMBER, api.LUA_TSTRING:
+			L.PushValue(arg(1))
+			L.ToString(-1)
+		default:
+			panic(unsupported("tostring of a " + L.TypeName(L.Type(arg(1)))))
+		}
+	case "type":
+		L.PushString(L.TypeName(L.Type(arg(1))))
+	case "math.type":
+		if L.Type(arg(1)) != api.LUA_TNUMBER {
+			L.PushNil()
+		} else if L.IsInteger(arg(1)) {
+			L.PushString("integer")
+		} else {
+			L.PushString("float")
+		}
+	case "math.tointeger":
+		if i, ok := L.ToIntegerX(arg(1)); ok {
+			L.PushInteger(i)
+		} else {
+			L.PushNil()
+		}
+	case "math.abs":
+		if L.IsInteger(arg(1)) {
+			if i := L.ToInteger(arg(1)); i < 0 {
+				L.PushInteger(-i)
+			} else {
+				L.PushInteger(i)
+			}
+		} else {
+			L.PushNumber(math.Abs(m.checkNumber(arg(1), e.fn)))
+		}
+	case "math.floor", "math.ceil":
+		if L.IsInteger(arg(1)) {
+			L.PushValue(arg(1))
+			break
+		}
+		mode := number.F2Ifloor
+		if e.fn == "math.ceil" {
+			mode = number.F2Iceil
+		}
+		f := m.checkNumber(arg(1), e.fn)
+		if i, ok := number.FloatToIntegerMode(f, mode); ok {
+			L.PushInteger(i)
+		} else if mode == number.F2Ifloor {
+			L.PushNumber(math.Floor(f))
+		} else {
+			L.PushNumber(math.Ceil(f))
+		}
+	case "eqT":
+		eq := L.Compare(arg(1), arg(2), api.LUA_OPEQ) && L.IsInteger(arg(1)) == L.IsInteger(arg(2))
+		L.PushBoolean(eq)
+	case "isNaN":
+		L.PushBoolean(!L.Compare(arg(1), arg(1), api.LUA_OPEQ))
+	default:
+		panic(unsupported(fmt.Sprintf("function '%s'", e.fn)))
+	}
+	if nargs > 0 {
+		L.Replace(base + 1)
+		L.SetTop(base + 1)
+	}
+}
+
+func (m *machine) checkNumber(idx int, fn string) float64 {
+	f, ok := m.L.ToNumberX(idx)
+	if !ok {
+		panic(fmt.Sprintf("bad argument #1 to '%s' (number expected, got %s)", fn, m.L.TypeName(m.L.Type(idx))))
+	}
+	return f
+}
@@ -0,0 +1,247 @@
+package conformance
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	tokEOF = iota
+	tokName
+	tokNumber
+	tokString
+	tokOp // operators, punctuation and keywords
+)
+
+type token struct {
+	kind int
+	text string // name, operator or keyword; the value of a string literal
+	line int
+}
+
+var keywords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true, "end": true,
+	"false": true, "for": true, "function": true, "goto": true, "if": true, "in": true,
+	"local": true, "nil": true, "not": true, "or": true, "repeat": true, "return": true,
+	"then": true, "true": true, "until": true, "while": true,
+}
+
+/* longest first, so that '...' wins over '..' and '//' over '/' */
+var operators = []string{
+	"...", "..", "==", "~=", "<=", ">=", "<<", ">>", "//", "::",
+	"+", "-", "*", "/", "%", "^", "#", "&", "~", "|", "<", ">", "=",
+	"(", ")", "{", "}", "[", "]", ";", ":", ",", ".",
+}
+
+func isNameChar(c byte, first bool) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || !first && '0' <= c && c <= '9'
+}
+
+/* split a chunk into tokens (llex) */
+func tokenize(src string) ([]token, error) {
+	var toks []token
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			i++
+		case strings.HasPrefix(src[i:], "--"):
+			i += 2
+			if level, ok := longBracket(src[i:]); ok {
+				body, n, err := readLongString(src[i:], level)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", line, err)
+				}
+				line += strings.Count(body, "\n")
+				i += n
+			} else {
+				for i < len(src) && src[i] != '\n' {
+					i++
+				}
+			}
+		case isNameChar(c, true):
+			j := i
+			for j < len(src) && isNameChar(src[j], false) {
+				j++
+			}
+			kind := tokName
+			if keywords[src[i:j]] {
+				kind = tokOp
+			}
+			toks = append(toks, token{kind, src[i:j], line})
+			i = j
+		case '0' <= c && c <= '9' || c == '.' && i+1 < len(src) && '0' <= src[i+1] && src[i+1] <= '9':
+			j := readNumeral(src, i)
+			toks = append(toks, token{tokNumber, src[i:j], line})
+			i = j
+		case c == '"' || c == '\'':
+			s, n, err := readString(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			toks = append(toks, token{tokString, s, line})
+			line += strings.Count(src[i:i+n], "\n")
+			i += n
+		case c == '[':
+			if level, ok := longBracket(src[i:]); ok {
+				s, n, err := readLongString(src[i:], level)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", line, err)
+				}
+				toks = append(toks, token{tokString, s, line})
+				line += strings.Count(src[i:i+n], "\n")
+				i += n
+				continue
+			}
+			fallthrough
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("line %d: unexpected symbol '%c'", line, c)
+			}
+			toks = append(toks, token{tokOp, op, line})
+			i += len(op)
+		}
+	}
+	return append(toks, token{tokEOF, "<eof>", line}), nil
+}
+
+/* end of the numeral starting at src[i], as read_numeral does */
+func readNumeral(src string, i int) int {
+	expo := "Ee"
+	if strings.HasPrefix(src[i:], "0x") || strings.HasPrefix(src[i:], "0X") {
+		expo = "Pp"
+		i += 2
+	}
+	for i < len(src) {
+		c := src[i]
+		if strings.IndexByte(expo, c) >= 0 && i+1 < len(src) && (src[i+1] == '+' || src[i+1] == '-') {
+			i += 2
+		} else if isNameChar(c, false) || c == '.' {
+			i++
+		} else {
+			break
+		}
+	}
+	return i
+}
+
+/* level of the long bracket '[' '='* '[' at the start of s */
+func longBracket(s string) (int, bool) {
+	if s == "" || s[0] != '[' {
+		return 0, false
+	}
+	level := 1
+	for level < len(s) && s[level] == '=' {
+		level++
+	}
+	return level - 1, level < len(s) && s[level] == '['
+}
+
+func readLongString(s string, level int) (string, int, error) {
+	open := level + 2
+	close := "]" + strings.Repeat("=", level) + "]"
+	end := strings.Index(s[open:], close)
+	if end < 0 {
+		return "", 0, fmt.Errorf("unfinished long string")
+	}
+	body := s[open : open+end]
+	if strings.HasPrefix(body, "\r\n") {
+		body = body[2:]
+	} else if strings.HasPrefix(body, "\n") {
+		body = body[1:]
+	}
+	return body, open + end + len(close), nil
+}
+
+/* the value of the quoted string at the start of s and its length in s */
+func readString(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); {
+		c := s[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\n':
+			return "", 0, fmt.Errorf("unfinished string")
+		case c != '\\':
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		i++ // skip '\\'
+		if i == len(s) {
+			break
+		}
+		c = s[i]
+		i++
+		switch c {
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n', '\n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'v':
+			b.WriteByte('\v')
+		case '\\', '"', '\'':
+			b.WriteByte(c)
+		case 'x':
+			if i+2 > len(s) {
+				return "", 0, fmt.Errorf("hexadecimal digit expected")
+			}
+			var v byte
+			if _, err := fmt.Sscanf(s[i:i+2], "%02x", &v); err != nil {
+				return "", 0, fmt.Errorf("hexadecimal digit expected")
+			}
+			b.WriteByte(v)
+			i += 2
+		case 'u':
+			end := strings.IndexByte(s[i:], '}')
+			var r rune
+			if i == len(s) || s[i] != '{' || end < 0 {
+				return "", 0, fmt.Errorf("missing '{' or '}' in \\u{xxxx}")
+			}
+			if _, err := fmt.Sscanf(s[i+1:i+end], "%x", &r); err != nil {
+				return "", 0, fmt.Errorf("hexadecimal digit expected")
+			}
+			b.WriteRune(r)
+			i += end + 1
+		case 'z':
+			for i < len(s) && strings.IndexByte(" \t\n\r\f\v", s[i]) >= 0 {
+				i++
+			}
+		default:
+			if c < '0' || c > '9' {
+				return "", 0, fmt.Errorf("invalid escape sequence '\\%c'", c)
+			}
+			v := int(c - '0')
+			for n := 1; n < 3 && i < len(s) && '0' <= s[i] && s[i] <= '9'; n++ {
+				v = v*10 + int(s[i]-'0')
+				i++
+			}
+			if v > 0xff {
+				return "", 0, fmt.Errorf("decimal escape too large")
+			}
+			b.WriteByte(byte(v))
+		}
+	}
+	return "", 0, fmt.Errorf("unfinished string")
+}
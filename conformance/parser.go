@@ -0,0 +1,246 @@
+package conformance
+
+import (
+	"fmt"
+
+	"github.com/uganh16/luago/number"
+)
+
+type expr interface{}
+
+type constant struct {
+	value interface{} // nil, bool, int64, float64 or string
+}
+
+/* variable or library field such as math.pi */
+type name struct {
+	name string
+}
+
+type unop struct {
+	op string
+	x  expr
+}
+
+type binop struct {
+	op   string
+	x, y expr
+}
+
+/* call of a harness builtin */
+type call struct {
+	fn   string
+	args []expr
+}
+
+const (
+	stmtAssert = iota
+	stmtLocal
+	stmtAssign
+)
+
+type stmt struct {
+	kind  int
+	line  int
+	names []string
+	exprs []expr
+}
+
+/* a statement or expression the harness cannot run */
+type unsupported string
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) test(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) check(op string) {
+	if !p.test(op) {
+		panic(unsupported(fmt.Sprintf("'%s' expected near '%s'", op, p.peek().text)))
+	}
+}
+
+func (p *parser) checkName() string {
+	t := p.next()
+	if t.kind != tokName {
+		panic(unsupported(fmt.Sprintf("name expected near '%s'", t.text)))
+	}
+	return t.text
+}
+
+/* assert(exp [, msg]) | local namelist ['=' explist] | namelist '=' explist */
+func (p *parser) statement() *stmt {
+	t := p.peek()
+	s := &stmt{line: t.line}
+	switch {
+	case t.kind == tokName && t.text == "assert":
+		p.next()
+		p.check("(")
+		s.kind = stmtAssert
+		s.exprs = p.exprList()
+		p.check(")")
+	case t.kind == tokOp && t.text == "local":
+		p.next()
+		s.kind = stmtLocal
+		s.names = p.nameList()
+		if p.test("=") {
+			s.exprs = p.exprList()
+		}
+	case t.kind == tokName:
+		s.kind = stmtAssign
+		s.names = p.nameList()
+		p.check("=")
+		s.exprs = p.exprList()
+	default:
+		panic(unsupported(fmt.Sprintf("'%s' statement", t.text)))
+	}
+	p.test(";")
+	return s
+}
+
+func (p *parser) nameList() []string {
+	names := []string{p.checkName()}
+	for p.test(",") {
+		names = append(names, p.checkName())
+	}
+	return names
+}
+
+func (p *parser) exprList() []expr {
+	exprs := []expr{p.expr(0)}
+	for p.test(",") {
+		exprs = append(exprs, p.expr(0))
+	}
+	return exprs
+}
+
+/* left and right priorities of binary operators (lparser.c) */
+var priority = map[string][2]int{
+	"+": {10, 10}, "-": {10, 10},
+	"*": {11, 11}, "%": {11, 11},
+	"^": {14, 13}, // right associative
+	"/": {11, 11}, "//": {11, 11},
+	"&": {6, 6}, "|": {4, 4}, "~": {5, 5},
+	"<<": {7, 7}, ">>": {7, 7},
+	"..": {9, 8}, // right associative
+	"==": {3, 3}, "<": {3, 3}, "<=": {3, 3},
+	"~=": {3, 3}, ">": {3, 3}, ">=": {3, 3},
+	"and": {2, 2}, "or": {1, 1},
+}
+
+const unaryPriority = 12
+
+/* subexpr: an expression whose binary operators bind tighter than limit */
+func (p *parser) expr(limit int) expr {
+	var e expr
+	if t := p.peek(); t.kind == tokOp && (t.text == "not" || t.text == "-" || t.text == "#" || t.text == "~") {
+		p.next()
+		e = &unop{t.text, p.expr(unaryPriority)}
+	} else {
+		e = p.simpleExpr()
+	}
+	for {
+		t := p.peek()
+		prio, ok := priority[t.text]
+		if t.kind != tokOp || !ok || prio[0] <= limit {
+			return e
+		}
+		p.next()
+		e = &binop{t.text, e, p.expr(prio[1])}
+	}
+}
+
+func (p *parser) simpleExpr() expr {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		if i, ok := number.ParseInteger(t.text); ok {
+			return &constant{i}
+		}
+		if f, ok := number.ParseFloat(t.text); ok {
+			return &constant{f}
+		}
+		panic(unsupported(fmt.Sprintf("malformed number near '%s'", t.text)))
+	case tokString:
+		return &constant{t.text}
+	case tokName:
+		n := t.text
+		for p.test(".") {
+			n += "." + p.checkName()
+		}
+		if t := p.peek(); t.kind == tokString || t.kind == tokOp && t.text == "(" {
+			return &call{n, p.args()}
+		}
+		return &name{n}
+	}
+	switch t.text {
+	case "nil":
+		return &constant{nil}
+	case "true":
+		return &constant{true}
+	case "false":
+		return &constant{false}
+	case "(":
+		e := p.expr(0)
+		p.check(")")
+		return &unop{"()", e}
+	}
+	panic(unsupported(fmt.Sprintf("unexpected symbol near '%s'", t.text)))
+}
+
+func (p *parser) args() []expr {
+	if t := p.peek(); t.kind == tokString {
+		p.next()
+		return []expr{&constant{t.text}}
+	}
+	p.check("(")
+	if p.test(")") {
+		return nil
+	}
+	args := p.exprList()
+	p.check(")")
+	return args
+}
+
+/* skip the statement at the current position, with any blocks it opens */
+func (p *parser) skipStatement() {
+	depth := 0
+	for {
+		t := p.next()
+		if t.kind == tokEOF {
+			return
+		}
+		if t.kind == tokOp {
+			switch t.text {
+			case "function", "do", "if", "repeat", "(", "{", "[":
+				depth++
+			case "end", "until", ")", "}", "]":
+				depth--
+			}
+		}
+		if next := p.peek(); depth <= 0 && (next.line > t.line || next.kind == tokOp && next.text == ";") {
+			p.test(";")
+			return
+		}
+	}
+}
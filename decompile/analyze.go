@@ -0,0 +1,272 @@
+package decompile
+
+import (
+	"github.com/uganh16/luago/cfg"
+	"github.com/uganh16/luago/vm"
+)
+
+/* collect every non-sequential transfer of control */
+func (f *function) analyze() {
+	for pc, i := range f.p.Code {
+		switch i.Opcode() {
+		case vm.OP_JMP, vm.OP_FORPREP, vm.OP_FORLOOP, vm.OP_TFORLOOP:
+			_, sbx := i.AsBx()
+			f.jumps = append(f.jumps, [2]int{pc, pc + 1 + sbx})
+		case vm.OP_LOADBOOL:
+			if _, _, c := i.ABC(); c != 0 {
+				f.jumps = append(f.jumps, [2]int{pc, pc + 2})
+			}
+		default:
+			if i.TestFlag() {
+				f.jumps = append(f.jumps, [2]int{pc, pc + 2})
+			}
+		}
+	}
+}
+
+func (f *function) isJumpTarget(pc int) bool {
+	for _, j := range f.jumps {
+		if j[1] == pc {
+			return true
+		}
+	}
+	return false
+}
+
+/* whether [from, to) is only entered by falling in or by jumps from the sources in allowed */
+func (f *function) closed(from, to int, allowed ...int) bool {
+	for _, j := range f.jumps {
+		src, dst := j[0], j[1]
+		if from <= src && src < to || dst < from || dst >= to {
+			continue
+		}
+		ok := false
+		for _, a := range allowed {
+			ok = ok || a == src
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func rkReg(x int) []int {
+	if x > 0xff {
+		return nil
+	}
+	return []int{x}
+}
+
+func span(from, n int) []int {
+	var regs []int
+	for r := from; r < from+n; r++ {
+		regs = append(regs, r)
+	}
+	return regs
+}
+
+/* registers read by the instruction at pc */
+func (f *function) reads(pc int) []int {
+	i := f.p.Code[pc]
+	a, b, c := i.ABC()
+	open := int(f.p.MaxStackSize) - a // everything up to the top
+	switch i.Opcode() {
+	case vm.OP_MOVE, vm.OP_UNM, vm.OP_BNOT, vm.OP_NOT, vm.OP_LEN:
+		return []int{b}
+	case vm.OP_GETTABUP:
+		return rkReg(c)
+	case vm.OP_GETTABLE, vm.OP_SELF:
+		return append([]int{b}, rkReg(c)...)
+	case vm.OP_SETTABUP, vm.OP_EQ, vm.OP_LT, vm.OP_LE,
+		vm.OP_ADD, vm.OP_SUB, vm.OP_MUL, vm.OP_MOD, vm.OP_POW, vm.OP_DIV, vm.OP_IDIV,
+		vm.OP_BAND, vm.OP_BOR, vm.OP_BXOR, vm.OP_SHL, vm.OP_SHR:
+		return append(rkReg(b), rkReg(c)...)
+	case vm.OP_SETUPVAL, vm.OP_TEST:
+		return []int{a}
+	case vm.OP_SETTABLE:
+		return append(append([]int{a}, rkReg(b)...), rkReg(c)...)
+	case vm.OP_CONCAT:
+		return span(b, c-b+1)
+	case vm.OP_TESTSET:
+		return []int{b}
+	case vm.OP_CALL, vm.OP_TAILCALL:
+		if b == 0 {
+			return span(a, open)
+		}
+		return span(a, b)
+	case vm.OP_RETURN:
+		if b == 0 {
+			return span(a, open)
+		}
+		return span(a, b-1)
+	case vm.OP_FORLOOP, vm.OP_FORPREP, vm.OP_TFORCALL:
+		return span(a, 3)
+	case vm.OP_JMP: // into a generic for, which takes over its state
+		_, sbx := i.AsBx()
+		if t := pc + 1 + sbx; t > pc && t < len(f.p.Code) && f.p.Code[t].Opcode() == vm.OP_TFORCALL {
+			ta, _, _ := f.p.Code[t].ABC()
+			return span(ta, 3)
+		}
+	case vm.OP_TFORLOOP:
+		return []int{a + 1}
+	case vm.OP_SETLIST:
+		if b == 0 {
+			return span(a, open)
+		}
+		return span(a, b+1)
+	case vm.OP_CLOSURE:
+		var regs []int
+		_, bx := i.ABx()
+		if bx < len(f.p.Protos) {
+			for _, upvalue := range f.p.Protos[bx].Upvalues {
+				if upvalue.InStack != 0 {
+					regs = append(regs, int(upvalue.Idx))
+				}
+			}
+		}
+		return regs
+	}
+	return nil
+}
+
+/* registers written by the instruction at pc; open results extend to the top */
+func (f *function) writes(pc int) []int {
+	i := f.p.Code[pc]
+	a, b, c := i.ABC()
+	switch i.Opcode() {
+	case vm.OP_SETTABUP, vm.OP_SETUPVAL, vm.OP_SETTABLE, vm.OP_JMP, vm.OP_EQ, vm.OP_LT,
+		vm.OP_LE, vm.OP_TEST, vm.OP_RETURN, vm.OP_SETLIST, vm.OP_EXTRAARG:
+		return nil
+	case vm.OP_LOADNIL:
+		return span(a, b+1)
+	case vm.OP_SELF:
+		return span(a, 2)
+	case vm.OP_TAILCALL:
+		return span(a, int(f.p.MaxStackSize)-a)
+	case vm.OP_CALL:
+		if c == 0 {
+			return span(a, int(f.p.MaxStackSize)-a)
+		}
+		return span(a, c-1)
+	case vm.OP_FORLOOP:
+		return []int{a, a + 3}
+	case vm.OP_TFORCALL:
+		return span(a+3, c)
+	case vm.OP_TFORLOOP:
+		return []int{a}
+	case vm.OP_VARARG:
+		if b == 0 {
+			return span(a, int(f.p.MaxStackSize)-a)
+		}
+		return span(a, b-1)
+	}
+	return []int{a}
+}
+
+func contains(regs []int, r int) bool {
+	for _, x := range regs {
+		if x == r {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * pc of the only use, within the same basic block, of the value written
+ * to register r at pc, or -1. A local variable starting on r counts as a
+ * use; the constructor stores of a NEWTABLE do not.
+ */
+func (f *function) useOf(pc, r int) int {
+	return f.useFrom(pc+1, f.g.BlockAt(pc), r, f.p.Code[pc].Opcode() == vm.OP_NEWTABLE)
+}
+
+/* like useOf, for a value that is in register r when block b is entered at from */
+func (f *function) useFrom(from int, b *cfg.Block, r int, constructor bool) int {
+	end := b.End
+	use := -1
+	for x := from; x <= end && x <= len(f.p.Code); x++ {
+		if f.startsLocal(x, r) {
+			if use >= 0 {
+				return -1
+			}
+			return x
+		}
+		if x == end {
+			if f.liveOut(b, r) {
+				return -1
+			}
+			return use
+		}
+		op := f.p.Code[x].Opcode()
+		if a, _, _ := f.p.Code[x].ABC(); constructor && a == r && (op == vm.OP_SETTABLE || op == vm.OP_SETLIST) {
+			if use >= 0 {
+				return -1
+			}
+		} else if contains(f.reads(x), r) {
+			if use >= 0 {
+				return -1
+			}
+			use = x
+			if op == vm.OP_FORPREP || op == vm.OP_JMP { // the state of a loop
+				return use
+			}
+		}
+		if contains(f.writes(x), r) {
+			return use
+		}
+	}
+	return -1
+}
+
+/* whether register r may be read after block b before being written again */
+func (f *function) liveOut(b *cfg.Block, r int) bool {
+	seen := map[*cfg.Block]bool{}
+	var visit func(b *cfg.Block) bool
+	visit = func(b *cfg.Block) bool {
+		if seen[b] {
+			return false
+		}
+		seen[b] = true
+		for pc := b.Start; pc < b.End; pc++ {
+			if contains(f.reads(pc), r) || f.startsLocal(pc, r) {
+				return true
+			}
+			if contains(f.writes(pc), r) {
+				return false
+			}
+		}
+		for _, s := range b.Succs {
+			if visit(s) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, s := range b.Succs {
+		if visit(s) {
+			return true
+		}
+	}
+	return false
+}
+
+/* whether a (named) local variable held by register r starts at pc */
+func (f *function) startsLocal(pc, r int) bool {
+	i := f.localAt(r, pc)
+	return i >= 0 && int(f.p.LocVars[i].StartPC) == pc && pc > 0
+}
+
+/* whether the values written to regs at pc all flow to one single use */
+func (f *function) foldable(pc int, regs ...int) bool {
+	use := -1
+	for _, r := range regs {
+		u := f.useOf(pc, r)
+		if u < 0 || use >= 0 && u != use {
+			return false
+		}
+		use = u
+	}
+	return use >= 0
+}
@@ -0,0 +1,249 @@
+package decompile
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/uganh16/luago/binary"
+	"github.com/uganh16/luago/cfg"
+)
+
+/* write Lua source reconstructed from the main function p */
+func Decompile(w io.Writer, p *binary.Prototype) error {
+	f := newFunction(p, []string{"_ENV"})
+	var sb strings.Builder
+	for _, l := range f.render(0) {
+		sb.WriteString(l)
+		sb.WriteByte('\n')
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+type line struct {
+	indent int
+	text   string
+	label  int    // pc of the label this line defines, or -1
+	decl   string // local introduced by this assignment, if any
+}
+
+type loop struct {
+	head int
+	exit int
+}
+
+type function struct {
+	p        *binary.Prototype
+	g        *cfg.Graph
+	upvalues []string
+	locNames []string // name of each LocVars entry; "" for internal ones
+	params   []string
+	lines    []line
+	indent   int
+	pending  map[int]*expr
+	jumps    [][2]int     // every non-sequential transfer (from, to)
+	labels   map[int]bool // labels referenced by gotos
+	placed   map[int]bool // labels already emitted
+	loops    []loop
+	temps    map[int]bool  // registers referred to by their r<n> name
+	declared map[int]bool  // LocVars entries already introduced
+	uses     map[int][]int // registers each pending expression reads
+	reading  []int         // registers read by the instruction being translated
+	join     int           // register an and/or value is being rebuilt in, or -1
+}
+
+func newFunction(p *binary.Prototype, upvalues []string) *function {
+	f := &function{
+		p:        p,
+		g:        cfg.Build(p),
+		upvalues: upvalues,
+		pending:  map[int]*expr{},
+		labels:   map[int]bool{},
+		temps:    map[int]bool{},
+		placed:   map[int]bool{},
+		declared: map[int]bool{},
+		uses:     map[int][]int{},
+		join:     -1,
+	}
+	seen := map[string]bool{}
+	for _, locVar := range p.LocVars {
+		n := locVar.VarName
+		if !isIdentifier(n) {
+			n = ""
+		} else if seen[n] { // shadowing; keep names unique
+			for i := 2; ; i++ {
+				if m := fmt.Sprintf("%s_%d", n, i); !seen[m] {
+					n = m
+					break
+				}
+			}
+		}
+		seen[n] = true
+		f.locNames = append(f.locNames, n)
+	}
+	for r := 0; r < int(p.NumParams); r++ {
+		f.params = append(f.params, f.regName(r, 0))
+	}
+	f.analyze()
+	return f
+}
+
+/* index into LocVars of the variable held by register r at pc, or -1 */
+func (f *function) localAt(r, pc int) int {
+	n := 0
+	for i, locVar := range f.p.LocVars {
+		if int(locVar.StartPC) <= pc && pc < int(locVar.EndPC) {
+			if n == r {
+				return i
+			}
+			n++
+		}
+	}
+	return -1
+}
+
+func (f *function) regName(r, pc int) string {
+	if i := f.localAt(r, pc); i >= 0 && f.locNames[i] != "" {
+		return f.locNames[i]
+	}
+	if r < int(f.p.NumParams) {
+		return fmt.Sprintf("a%d", r+1)
+	}
+	f.temps[r] = true
+	return fmt.Sprintf("r%d", r)
+}
+
+/* name a value written to r at pc is stored under, and whether that introduces a local; temporaries are not yet recorded */
+func (f *function) targetName(r, pc int) (string, bool) {
+	if i := f.localAt(r, pc+1); i >= 0 && f.locNames[i] != "" && int(f.p.LocVars[i].StartPC) == pc+1 {
+		return f.locNames[i], true
+	}
+	if i := f.localAt(r, pc); i >= 0 && f.locNames[i] != "" {
+		return f.locNames[i], false
+	}
+	if r < int(f.p.NumParams) {
+		return fmt.Sprintf("a%d", r+1), false
+	}
+	return fmt.Sprintf("r%d", r), false
+}
+
+func (f *function) upvalueName(i int) string {
+	if i < len(f.upvalues) {
+		return f.upvalues[i]
+	}
+	return fmt.Sprintf("u%d", i)
+}
+
+func (f *function) emit(format string, a ...any) {
+	f.lines = append(f.lines, line{indent: f.indent, text: fmt.Sprintf(format, a...), label: -1})
+}
+
+func (f *function) emitDecl(decl, format string, a ...any) {
+	f.emit(format, a...)
+	f.lines[len(f.lines)-1].decl = decl
+}
+
+func (f *function) emitLabel(pc int) {
+	f.placed[pc] = true
+	f.lines = append(f.lines, line{indent: f.indent, text: fmt.Sprintf("::L%d::", pc+1), label: pc})
+}
+
+func (f *function) emitGoto(pc int) {
+	for i := len(f.loops) - 1; i >= 0; i-- {
+		if f.loops[i].exit == pc && i == len(f.loops)-1 {
+			f.emit("break")
+			return
+		}
+	}
+	f.labels[pc] = true
+	f.emit("goto L%d", pc+1)
+}
+
+/* decompile the body and render it indented by depth */
+func (f *function) render(depth int) []string {
+	f.emitRange(0, len(f.p.Code))
+	f.flushAll()
+	// a trailing 'return' without values is implicit
+	if n := len(f.lines); n > 0 && f.lines[n-1].text == "return" && f.lines[n-1].indent == 0 {
+		f.lines = f.lines[:n-1]
+	}
+
+	hoist := len(f.labels) > 0
+	var locals []string
+	var out []string
+	pad := func(indent int) string {
+		return strings.Repeat("  ", depth+indent)
+	}
+	for _, l := range f.lines {
+		if l.label >= 0 && !f.labels[l.label] {
+			continue
+		}
+		text := l.text
+		if l.decl != "" {
+			if hoist {
+				locals = append(locals, l.decl)
+			} else {
+				text = "local " + text
+			}
+		}
+		for _, s := range strings.Split(text, "\n") {
+			out = append(out, pad(l.indent)+s)
+		}
+	}
+
+	var temps []int
+	for r := range f.temps {
+		temps = append(temps, r)
+	}
+	sort.Ints(temps)
+	for _, r := range temps {
+		locals = append(locals, fmt.Sprintf("r%d", r))
+	}
+	if len(locals) > 0 {
+		out = append([]string{pad(0) + "local " + strings.Join(unique(locals), ", ")}, out...)
+	}
+	return out
+}
+
+func unique(names []string) []string {
+	seen := map[string]bool{}
+	var res []string
+	for _, n := range names {
+		if !seen[n] {
+			seen[n] = true
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+/* source of a nested function as an expression; it refers to register self as selfName */
+func (f *function) closure(bx, pc, self int, selfName string) *expr {
+	if bx >= len(f.p.Protos) {
+		return atom("nil --[[ missing function ]]")
+	}
+	p := f.p.Protos[bx]
+	upvalues := make([]string, len(p.Upvalues))
+	for i, upvalue := range p.Upvalues {
+		if upvalue.InStack != 0 && int(upvalue.Idx) == self {
+			upvalues[i] = selfName
+		} else if upvalue.InStack != 0 {
+			upvalues[i] = f.regName(int(upvalue.Idx), pc)
+		} else {
+			upvalues[i] = f.upvalueName(int(upvalue.Idx))
+		}
+	}
+	g := newFunction(p, upvalues)
+	params := g.params
+	if p.IsVararg {
+		params = append(params, "...")
+	}
+	body := g.render(1)
+	text := "function(" + strings.Join(params, ", ") + ")\n"
+	for _, l := range body {
+		text += l + "\n"
+	}
+	return &expr{text: text + "end", prec: precAtom}
+}
@@ -0,0 +1,346 @@
+package decompile
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/uganh16/luago/binary"
+	"github.com/uganh16/luago/vm"
+)
+
+func decompile(t *testing.T, p *binary.Prototype) string {
+	t.Helper()
+	p.Upvalues = []binary.Upvalue{{InStack: 1, Idx: 0}}
+	var sb strings.Builder
+	if err := Decompile(&sb, p); err != nil {
+		t.Fatal(err)
+	}
+	return sb.String()
+}
+
+func check(t *testing.T, p *binary.Prototype, want string) {
+	t.Helper()
+	if got := decompile(t, p); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWhile(t *testing.T) {
+	check(t, &binary.Prototype{
+		MaxStackSize: 2,
+		Code: []vm.Instruction{
+			vm.CreateABx(vm.OP_LOADK, 0, 0),
+			vm.CreateABC(vm.OP_LT, 0, 0, 0x101),
+			vm.CreateAsBx(vm.OP_JMP, 0, 6),
+			vm.CreateABC(vm.OP_EQ, 0, 0, 0x102),
+			vm.CreateAsBx(vm.OP_JMP, 0, 2),
+			vm.CreateABC(vm.OP_ADD, 0, 0, 0x103),
+			vm.CreateAsBx(vm.OP_JMP, 0, 1),
+			vm.CreateABC(vm.OP_ADD, 0, 0, 0x100),
+			vm.CreateAsBx(vm.OP_JMP, 0, -8),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		Constants: []interface{}{int64(1), int64(10), int64(5), int64(2)},
+		LocVars:   []binary.LocVar{{VarName: "x", StartPC: 1, EndPC: 10}},
+	}, `local x = 1
+while x < 10 do
+  if x == 5 then
+    x = x + 2
+  else
+    x = x + 1
+  end
+end
+`)
+}
+
+func TestNumericFor(t *testing.T) {
+	check(t, &binary.Prototype{
+		MaxStackSize: 5,
+		Code: []vm.Instruction{
+			vm.CreateABx(vm.OP_LOADK, 0, 0),
+			vm.CreateABx(vm.OP_LOADK, 1, 1),
+			vm.CreateABx(vm.OP_LOADK, 2, 2),
+			vm.CreateABx(vm.OP_LOADK, 3, 1),
+			vm.CreateAsBx(vm.OP_FORPREP, 1, 1),
+			vm.CreateABC(vm.OP_ADD, 0, 0, 4),
+			vm.CreateAsBx(vm.OP_FORLOOP, 1, -2),
+			vm.CreateABC(vm.OP_RETURN, 0, 2, 0),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		Constants: []interface{}{int64(0), int64(1), int64(10)},
+		LocVars: []binary.LocVar{
+			{VarName: "t", StartPC: 1, EndPC: 9},
+			{VarName: "(for index)", StartPC: 4, EndPC: 7},
+			{VarName: "(for limit)", StartPC: 4, EndPC: 7},
+			{VarName: "(for step)", StartPC: 4, EndPC: 7},
+			{VarName: "i", StartPC: 5, EndPC: 6},
+		},
+	}, `local t = 0
+for i = 1, 10 do
+  t = t + i
+end
+return t
+`)
+}
+
+func TestGenericFor(t *testing.T) {
+	check(t, &binary.Prototype{
+		MaxStackSize: 9,
+		Code: []vm.Instruction{
+			vm.CreateABC(vm.OP_GETTABUP, 0, 0, 0x100),
+			vm.CreateABC(vm.OP_GETTABUP, 1, 0, 0x101),
+			vm.CreateABC(vm.OP_CALL, 0, 2, 4),
+			vm.CreateAsBx(vm.OP_JMP, 0, 5),
+			vm.CreateABC(vm.OP_GETTABUP, 5, 0, 0x102),
+			vm.CreateABC(vm.OP_SELF, 5, 5, 0x103),
+			vm.CreateABC(vm.OP_MOVE, 7, 3, 0),
+			vm.CreateABC(vm.OP_MOVE, 8, 4, 0),
+			vm.CreateABC(vm.OP_CALL, 5, 4, 1),
+			vm.CreateABC(vm.OP_TFORCALL, 0, 0, 2),
+			vm.CreateAsBx(vm.OP_TFORLOOP, 2, -7),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		Constants: []interface{}{"pairs", "t", "obj", "m"},
+		LocVars: []binary.LocVar{
+			{VarName: "(for generator)", StartPC: 3, EndPC: 11},
+			{VarName: "(for state)", StartPC: 3, EndPC: 11},
+			{VarName: "(for control)", StartPC: 3, EndPC: 11},
+			{VarName: "k", StartPC: 4, EndPC: 9},
+			{VarName: "v", StartPC: 4, EndPC: 9},
+		},
+		UpvalueNames: []string{"_ENV"},
+	}, `for k, v in pairs(t) do
+  obj:m(k, v)
+end
+`)
+}
+
+func TestConstructor(t *testing.T) {
+	check(t, &binary.Prototype{
+		IsVararg:     true,
+		MaxStackSize: 4,
+		Code: []vm.Instruction{
+			vm.CreateABC(vm.OP_NEWTABLE, 0, 2, 1),
+			vm.CreateABx(vm.OP_LOADK, 1, 0),
+			vm.CreateABx(vm.OP_LOADK, 2, 1),
+			vm.CreateABC(vm.OP_SETTABLE, 0, 0x102, 0x103),
+			vm.CreateABC(vm.OP_VARARG, 3, 0, 0),
+			vm.CreateABC(vm.OP_SETLIST, 0, 0, 1),
+			vm.CreateABC(vm.OP_RETURN, 0, 2, 0),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		Constants: []interface{}{int64(1), int64(2), "x", int64(3)},
+		LocVars:   []binary.LocVar{{VarName: "t", StartPC: 6, EndPC: 8}},
+	}, `local t = {x = 3, 1, 2, ...}
+return t
+`)
+}
+
+func TestElseif(t *testing.T) {
+	check(t, &binary.Prototype{
+		IsVararg:     true,
+		MaxStackSize: 3,
+		Code: []vm.Instruction{
+			vm.CreateABC(vm.OP_VARARG, 0, 2, 0),
+			vm.CreateABC(vm.OP_EQ, 0, 0, 0x100),
+			vm.CreateAsBx(vm.OP_JMP, 0, 4),
+			vm.CreateABC(vm.OP_GETTABUP, 1, 0, 0x101),
+			vm.CreateABx(vm.OP_LOADK, 2, 0),
+			vm.CreateABC(vm.OP_CALL, 1, 2, 1),
+			vm.CreateAsBx(vm.OP_JMP, 0, 9),
+			vm.CreateABC(vm.OP_EQ, 0, 0, 0x102),
+			vm.CreateAsBx(vm.OP_JMP, 0, 4),
+			vm.CreateABC(vm.OP_GETTABUP, 1, 0, 0x101),
+			vm.CreateABx(vm.OP_LOADK, 2, 2),
+			vm.CreateABC(vm.OP_CALL, 1, 2, 1),
+			vm.CreateAsBx(vm.OP_JMP, 0, 3),
+			vm.CreateABC(vm.OP_GETTABUP, 1, 0, 0x101),
+			vm.CreateABx(vm.OP_LOADK, 2, 3),
+			vm.CreateABC(vm.OP_CALL, 1, 2, 1),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		Constants: []interface{}{int64(1), "f", int64(2), int64(3)},
+		LocVars:   []binary.LocVar{{VarName: "x", StartPC: 1, EndPC: 17}},
+	}, `local x = ...
+if x == 1 then
+  f(1)
+elseif x == 2 then
+  f(2)
+else
+  f(3)
+end
+`)
+}
+
+func TestNegatedCall(t *testing.T) {
+	check(t, &binary.Prototype{
+		IsVararg:     true,
+		MaxStackSize: 2,
+		Code: []vm.Instruction{
+			vm.CreateABx(vm.OP_LOADK, 0, 0),
+			vm.CreateABC(vm.OP_SELF, 0, 0, 0x101),
+			vm.CreateABC(vm.OP_CALL, 0, 2, 2),
+			vm.CreateABC(vm.OP_TEST, 0, 0, 0),
+			vm.CreateAsBx(vm.OP_JMP, 0, 2),
+			vm.CreateABC(vm.OP_GETTABUP, 0, 0, 0x102),
+			vm.CreateABC(vm.OP_CALL, 0, 1, 1),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		Constants:    []interface{}{"abc", "upper", "f"},
+		Upvalues:     []binary.Upvalue{{InStack: 1, Idx: 0}},
+		UpvalueNames: []string{"_ENV"},
+	}, `if ("abc"):upper() then
+  f()
+end
+`)
+}
+
+func TestNegatedEquality(t *testing.T) {
+	check(t, &binary.Prototype{
+		IsVararg:     true,
+		MaxStackSize: 2,
+		Code: []vm.Instruction{
+			vm.CreateABC(vm.OP_VARARG, 0, 2, 0),
+			vm.CreateABC(vm.OP_EQ, 0, 0, 0x100),
+			vm.CreateAsBx(vm.OP_JMP, 0, 2),
+			vm.CreateABC(vm.OP_GETTABUP, 1, 0, 0x101),
+			vm.CreateABC(vm.OP_CALL, 1, 1, 1),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		Constants:    []interface{}{" == ", "f"},
+		LocVars:      []binary.LocVar{{VarName: "x", StartPC: 1, EndPC: 6}},
+		Upvalues:     []binary.Upvalue{{InStack: 1, Idx: 0}},
+		UpvalueNames: []string{"_ENV"},
+	}, `local x = ...
+if x == " == " then
+  f()
+end
+`)
+}
+
+func TestShortCircuit(t *testing.T) {
+	check(t, &binary.Prototype{
+		NumParams:    2,
+		MaxStackSize: 3,
+		Code: []vm.Instruction{
+			vm.CreateABC(vm.OP_TESTSET, 2, 0, 0),
+			vm.CreateAsBx(vm.OP_JMP, 0, 1),
+			vm.CreateABC(vm.OP_MOVE, 2, 1, 0),
+			vm.CreateABC(vm.OP_RETURN, 2, 2, 0),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		LocVars: []binary.LocVar{
+			{VarName: "a", StartPC: 0, EndPC: 5},
+			{VarName: "b", StartPC: 0, EndPC: 5},
+			{VarName: "c", StartPC: 3, EndPC: 5},
+		},
+	}, `local c = a and b
+return c
+`)
+
+	check(t, &binary.Prototype{
+		NumParams:    3,
+		MaxStackSize: 4,
+		Code: []vm.Instruction{
+			vm.CreateABC(vm.OP_TESTSET, 3, 0, 1),
+			vm.CreateAsBx(vm.OP_JMP, 0, 3),
+			vm.CreateABC(vm.OP_TESTSET, 3, 1, 0),
+			vm.CreateAsBx(vm.OP_JMP, 0, 1),
+			vm.CreateABC(vm.OP_MOVE, 3, 2, 0),
+			vm.CreateABC(vm.OP_RETURN, 3, 2, 0),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		LocVars: []binary.LocVar{
+			{VarName: "a", StartPC: 0, EndPC: 7},
+			{VarName: "b", StartPC: 0, EndPC: 7},
+			{VarName: "c", StartPC: 0, EndPC: 7},
+		},
+	}, `return a or b and c
+`)
+}
+
+func TestRepeat(t *testing.T) {
+	check(t, &binary.Prototype{
+		MaxStackSize: 2,
+		Code: []vm.Instruction{
+			vm.CreateABx(vm.OP_LOADK, 0, 0),
+			vm.CreateABC(vm.OP_ADD, 0, 0, 0x101),
+			vm.CreateABC(vm.OP_LE, 0, 0x102, 0),
+			vm.CreateAsBx(vm.OP_JMP, 0, -3),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		Constants: []interface{}{int64(0), int64(1), int64(10)},
+		LocVars:   []binary.LocVar{{VarName: "i", StartPC: 1, EndPC: 5}},
+	}, `local i = 0
+repeat
+  i = i + 1
+until 10 <= i
+`)
+}
+
+func TestClosure(t *testing.T) {
+	fact := &binary.Prototype{
+		NumParams:    1,
+		MaxStackSize: 3,
+		Code: []vm.Instruction{
+			vm.CreateABC(vm.OP_EQ, 0, 0, 0x100),
+			vm.CreateAsBx(vm.OP_JMP, 0, 2),
+			vm.CreateABx(vm.OP_LOADK, 1, 1),
+			vm.CreateABC(vm.OP_RETURN, 1, 2, 0),
+			vm.CreateABC(vm.OP_GETUPVAL, 1, 0, 0),
+			vm.CreateABC(vm.OP_SUB, 2, 0, 0x101),
+			vm.CreateABC(vm.OP_CALL, 1, 2, 2),
+			vm.CreateABC(vm.OP_MUL, 1, 0, 1),
+			vm.CreateABC(vm.OP_RETURN, 1, 2, 0),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		Constants: []interface{}{int64(0), int64(1)},
+		Upvalues:  []binary.Upvalue{{InStack: 1, Idx: 0}},
+		LocVars:   []binary.LocVar{{VarName: "n", StartPC: 0, EndPC: 10}},
+	}
+	check(t, &binary.Prototype{
+		MaxStackSize: 3,
+		Code: []vm.Instruction{
+			vm.CreateABx(vm.OP_CLOSURE, 0, 0),
+			vm.CreateABC(vm.OP_MOVE, 1, 0, 0),
+			vm.CreateABx(vm.OP_LOADK, 2, 0),
+			vm.CreateABC(vm.OP_TAILCALL, 1, 2, 0),
+			vm.CreateABC(vm.OP_RETURN, 1, 0, 0),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		Constants: []interface{}{int64(5)},
+		Protos:    []*binary.Prototype{fact},
+		LocVars:   []binary.LocVar{{VarName: "fact", StartPC: 1, EndPC: 6}},
+	}, `local function fact(n)
+  if n == 0 then
+    return 1
+  end
+  return n * fact(n - 1)
+end
+return fact(5)
+`)
+}
+
+func TestStripped(t *testing.T) {
+	// a jump into the middle of a loop cannot be structured
+	check(t, &binary.Prototype{
+		NumParams:    1,
+		MaxStackSize: 2,
+		Code: []vm.Instruction{
+			vm.CreateABC(vm.OP_TEST, 0, 0, 0),
+			vm.CreateAsBx(vm.OP_JMP, 0, 1),
+			vm.CreateABC(vm.OP_ADD, 0, 0, 0x100),
+			vm.CreateABC(vm.OP_SUB, 0, 0, 0x100),
+			vm.CreateAsBx(vm.OP_JMP, 0, -3),
+		},
+		Constants: []interface{}{int64(1)},
+	}, `if not a1 then
+  goto L4
+end
+::L3::
+a1 = a1 + 1
+::L4::
+a1 = a1 - 1
+goto L3
+`)
+}
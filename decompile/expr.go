@@ -0,0 +1,171 @@
+package decompile
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/uganh16/luago/binary"
+)
+
+/* operator precedences, from lowest to highest */
+const (
+	precOr = iota + 1
+	precAnd
+	precCompare
+	precBor
+	precBxor
+	precBand
+	precShift
+	precConcat
+	precAdd
+	precMul
+	precUnary
+	precPow
+	precAtom
+)
+
+type expr struct {
+	text   string
+	prec   int
+	prefix bool       // can be called or indexed without parentheses
+	table  *tableExpr // pending table constructor
+	method *expr      // object of a pending method (SELF)
+	name   string     // method name (SELF)
+	self   bool       // the object slot of a pending method
+	n      int        // number of values of a pending multiple-result call (0 if open)
+	multi  bool       // expression yields multiple values
+	op     string     // operator of a binary or unary operation
+	x, y   *expr      // its operands (y is nil for a unary operation)
+}
+
+/* entries in the order the bytecode stores them, so a multi-value item stays last */
+type tableExpr struct {
+	entries []string
+}
+
+func atom(text string) *expr {
+	return &expr{text: text, prec: precAtom}
+}
+
+func name(text string) *expr {
+	return &expr{text: text, prec: precAtom, prefix: true}
+}
+
+func (e *expr) String() string {
+	if e.table != nil {
+		if len(e.table.entries) == 0 {
+			return "{}"
+		}
+		return "{" + strings.Join(e.table.entries, ", ") + "}"
+	}
+	return e.text
+}
+
+/* e as the prefix of a call or an indexing */
+func (e *expr) asPrefix() string {
+	if e.prefix {
+		return e.String()
+	}
+	return "(" + e.String() + ")"
+}
+
+/* e truncated to a single value */
+func (e *expr) single() *expr {
+	if e.multi {
+		return &expr{text: "(" + e.text + ")", prec: precAtom, prefix: true}
+	}
+	return e
+}
+
+func binop(op string, prec int, a, b *expr) *expr {
+	rightAssoc := prec == precConcat || prec == precPow
+	l, r := a.String(), b.String()
+	if a.prec < prec || (rightAssoc && a.prec == prec) {
+		l = "(" + l + ")"
+	}
+	assoc := prec == precAnd || prec == precOr // grouping does not change the value
+	if b.prec < prec || (!rightAssoc && !assoc && b.prec == prec) {
+		r = "(" + r + ")"
+	}
+	return &expr{text: l + " " + op + " " + r, prec: prec, op: op, x: a, y: b}
+}
+
+func unary(op string, a *expr) *expr {
+	s := a.String()
+	if a.prec < precUnary || strings.HasPrefix(s, "-") && op == "-" {
+		s = "(" + s + ")"
+	}
+	text := op + s
+	if op == "not" {
+		text = "not " + s
+	}
+	return &expr{text: text, prec: precUnary, op: op, x: a}
+}
+
+func index(t, k *expr) *expr {
+	if isIdentifier(k.text) && k.prec == precAtom && strings.HasPrefix(k.text, "\"") {
+		return name(t.asPrefix() + "." + k.text[1:len(k.text)-1])
+	}
+	return name(t.asPrefix() + "[" + k.String() + "]")
+}
+
+func isIdentifier(s string) bool {
+	if strings.HasPrefix(s, "\"") && strings.HasSuffix(s, "\"") && len(s) >= 2 {
+		s = s[1 : len(s)-1]
+	}
+	if s == "" || keywords[s] {
+		return false
+	}
+	for i, c := range s {
+		if !(c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || i > 0 && '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+var keywords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true, "end": true,
+	"false": true, "for": true, "function": true, "goto": true, "if": true, "in": true,
+	"local": true, "nil": true, "not": true, "or": true, "repeat": true, "return": true,
+	"then": true, "true": true, "until": true, "while": true,
+}
+
+func constant(k interface{}) *expr {
+	switch k := k.(type) {
+	case nil:
+		return atom("nil")
+	case bool:
+		return atom(fmt.Sprintf("%t", k))
+	case int64:
+		if k < 0 {
+			if k == math.MinInt64 {
+				return &expr{text: "math.mininteger", prec: precAtom, prefix: true}
+			}
+			return &expr{text: fmt.Sprintf("%d", k), prec: precUnary}
+		}
+		return atom(fmt.Sprintf("%d", k))
+	case float64:
+		switch {
+		case math.IsInf(k, 1):
+			return &expr{text: "1/0", prec: precMul}
+		case math.IsInf(k, -1):
+			return &expr{text: "-1/0", prec: precMul}
+		case math.IsNaN(k):
+			return &expr{text: "0/0", prec: precMul}
+		}
+		s := fmt.Sprintf("%.17g", k)
+		if !strings.ContainsAny(s, ".eEn") {
+			s += ".0"
+		}
+		if k < 0 || k == 0 && math.Signbit(k) {
+			return &expr{text: s, prec: precUnary}
+		}
+		return atom(s)
+	case string:
+		return atom(binary.QuoteString(k))
+	default:
+		return atom("nil --[[ ? ]]")
+	}
+}
@@ -0,0 +1,497 @@
+package decompile
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/uganh16/luago/binary"
+	"github.com/uganh16/luago/vm"
+)
+
+/* value of register r read at pc, folding a pending expression */
+func (f *function) operand(r, pc int) *expr {
+	if e := f.pending[r]; e != nil {
+		delete(f.pending, r)
+		f.reading = append(f.reading, f.uses[r]...)
+		return e
+	}
+	f.reading = append(f.reading, r)
+	return name(f.regName(r, pc))
+}
+
+func (f *function) rk(x, pc int) *expr {
+	if x > 0xff {
+		return f.constant(x & 0xff)
+	}
+	return f.operand(x, pc).single()
+}
+
+func (f *function) constant(idx int) *expr {
+	if idx < len(f.p.Constants) {
+		return constant(f.p.Constants[idx])
+	}
+	return atom("nil --[[ missing constant ]]")
+}
+
+/* n values starting at register from; n < 0 means up to an open result */
+func (f *function) operands(from, n, pc int) []string {
+	var args []string
+	if n < 0 {
+		n = 0
+		for r := from; r < int(f.p.MaxStackSize); r++ {
+			if e := f.pending[r]; e != nil && e.multi && e.n == 0 {
+				n = r - from + 1
+				break
+			}
+		}
+	}
+	for r := from; r < from+n; r++ {
+		e := f.operand(r, pc)
+		if e.multi && e.n > 0 { // covers the following registers too
+			r += e.n - 1
+		} else if r < from+n-1 {
+			e = e.single()
+		}
+		args = append(args, e.String())
+	}
+	return args
+}
+
+/* emit pending expressions that would observe a write to register r */
+func (f *function) clobber(r int) {
+	if e := f.pending[r]; e != nil {
+		f.flush(r)
+	}
+	for x, e := range f.pending {
+		if contains(f.uses[x], r) && e != nil {
+			f.flush(x)
+		}
+	}
+}
+
+func (f *function) flush(r int) {
+	e := f.pending[r]
+	delete(f.pending, r)
+	if e.self {
+		return // flushed with its method
+	}
+	if e.method != nil {
+		obj := e.method
+		f.emit("%s = %s", f.tempName(r+1), obj)
+		f.emit("%s = %s", f.tempName(r), index(name(f.tempName(r+1)), atom(binary.QuoteString(e.name))))
+		delete(f.pending, r+1)
+		return
+	}
+	if e.multi && e.n > 1 {
+		var names []string
+		for x := r; x < r+e.n; x++ {
+			names = append(names, f.tempName(x))
+		}
+		f.emit("%s = %s", strings.Join(names, ", "), e)
+		return
+	}
+	f.emit("%s = %s", f.tempName(r), e)
+}
+
+func (f *function) flushAll() {
+	var regs []int
+	for r := range f.pending {
+		regs = append(regs, r)
+	}
+	sort.Ints(regs)
+	for _, r := range regs {
+		if f.pending[r] != nil {
+			f.flush(r)
+		}
+	}
+}
+
+func (f *function) tempName(r int) string {
+	f.temps[r] = true
+	return fmt.Sprintf("r%d", r)
+}
+
+/* store e into register r at pc */
+func (f *function) assign(r, pc int, e *expr) {
+	f.clobber(r)
+	if r == f.join {
+		f.pending[r] = e
+		f.uses[r] = f.reading
+		return
+	}
+	if f.isTemp(r, pc) && f.foldable(pc, r) {
+		f.pending[r] = e
+		f.uses[r] = f.reading
+		return
+	}
+	target, decl := f.targetName(r, pc)
+	if decl {
+		f.declared[f.localAt(r, pc+1)] = true
+		f.emitDecl(target, "%s = %s", target, e)
+	} else if f.isTemp(r, pc) {
+		f.emit("%s = %s", f.tempName(r), e)
+	} else {
+		f.emit("%s = %s", target, e)
+	}
+}
+
+/* store a multiple-value expression into registers a..a+n-1 */
+func (f *function) assignMulti(a, n, pc int, e *expr) {
+	var targets []string
+	for r := a; r < a+n; r++ {
+		f.clobber(r)
+	}
+	if n > 1 && f.foldable(pc, span(a, n)...) {
+		e.n = n
+		f.pending[a] = e
+		f.uses[a] = f.reading
+		return
+	}
+	for r := a; r < a+n; r++ {
+		t, d := f.targetName(r, pc)
+		if d || f.isTemp(r, pc) { // named ones are bound when the locals start
+			t = f.tempName(r)
+		}
+		targets = append(targets, t)
+	}
+	f.emit("%s = %s", strings.Join(targets, ", "), e)
+}
+
+/* condition under which the jump following the test at pc is taken */
+func (f *function) jumpCondition(pc int) *expr {
+	i := f.p.Code[pc]
+	a, b, c := i.ABC()
+	switch i.Opcode() {
+	case vm.OP_EQ, vm.OP_LT, vm.OP_LE:
+		l, r := f.rk(b, pc), f.rk(c, pc)
+		op := map[int]string{vm.OP_EQ: "==", vm.OP_LT: "<", vm.OP_LE: "<="}[i.Opcode()]
+		if a != 0 {
+			return binop(op, precCompare, l, r)
+		}
+		if i.Opcode() == vm.OP_EQ {
+			return binop("~=", precCompare, l, r)
+		}
+		return unary("not", binop(op, precCompare, l, r))
+	case vm.OP_TEST:
+		if c != 0 {
+			return f.operand(a, pc).single()
+		}
+		return unary("not", f.operand(a, pc).single())
+	case vm.OP_TESTSET:
+		v := f.testSetValue(b, pc)
+		if c != 0 {
+			return v
+		}
+		return unary("not", v)
+	}
+	return atom("false")
+}
+
+func negate(e *expr) *expr {
+	switch e.op {
+	case "not":
+		return e.x
+	case "==":
+		return binop("~=", precCompare, e.x, e.y)
+	case "~=":
+		return binop("==", precCompare, e.x, e.y)
+	}
+	return unary("not", e)
+}
+
+var arithOps = map[int]struct {
+	op   string
+	prec int
+}{
+	vm.OP_ADD: {"+", precAdd}, vm.OP_SUB: {"-", precAdd},
+	vm.OP_MUL: {"*", precMul}, vm.OP_MOD: {"%", precMul}, vm.OP_DIV: {"/", precMul}, vm.OP_IDIV: {"//", precMul},
+	vm.OP_POW:  {"^", precPow},
+	vm.OP_BAND: {"&", precBand}, vm.OP_BOR: {"|", precBor}, vm.OP_BXOR: {"~", precBxor},
+	vm.OP_SHL: {"<<", precShift}, vm.OP_SHR: {">>", precShift},
+}
+
+/* translate the instruction at pc into statements; returns the next pc */
+func (f *function) instruction(pc int) int {
+	i := f.p.Code[pc]
+	a, b, c := i.ABC()
+	_, bx := i.ABx()
+	_, sbx := i.AsBx()
+	f.reading = nil
+
+	switch op := i.Opcode(); op {
+	case vm.OP_MOVE:
+		f.assign(a, pc, f.operand(b, pc).single())
+	case vm.OP_LOADK:
+		f.assign(a, pc, f.constant(bx))
+	case vm.OP_LOADKX:
+		if pc+1 < len(f.p.Code) {
+			f.assign(a, pc, f.constant(f.p.Code[pc+1].Ax()))
+		}
+		return pc + 2
+	case vm.OP_LOADBOOL:
+		f.assign(a, pc, atom(fmt.Sprintf("%t", b != 0)))
+		if c != 0 {
+			f.flushAll()
+			f.emitGoto(pc + 2)
+		}
+	case vm.OP_LOADNIL:
+		for r := a; r <= a+b; r++ {
+			f.assign(r, pc, atom("nil"))
+		}
+	case vm.OP_GETUPVAL:
+		f.assign(a, pc, name(f.upvalueName(b)))
+	case vm.OP_GETTABUP:
+		k := f.rk(c, pc)
+		if f.upvalueName(b) == "_ENV" && isIdentifier(k.text) && strings.HasPrefix(k.text, "\"") {
+			f.assign(a, pc, name(k.text[1:len(k.text)-1]))
+		} else {
+			f.assign(a, pc, index(name(f.upvalueName(b)), k))
+		}
+	case vm.OP_GETTABLE:
+		t := f.operand(b, pc).single()
+		f.assign(a, pc, index(t, f.rk(c, pc)))
+	case vm.OP_SETTABUP:
+		k, v := f.rk(b, pc), f.rk(c, pc)
+		f.flushAll()
+		if f.upvalueName(a) == "_ENV" && isIdentifier(k.text) && strings.HasPrefix(k.text, "\"") {
+			f.emit("%s = %s", k.text[1:len(k.text)-1], v)
+		} else {
+			f.emit("%s = %s", index(name(f.upvalueName(a)), k), v)
+		}
+	case vm.OP_SETUPVAL:
+		v := f.operand(a, pc).single()
+		f.flushAll()
+		f.emit("%s = %s", f.upvalueName(b), v)
+	case vm.OP_SETTABLE:
+		k, v := f.rk(b, pc), f.rk(c, pc)
+		if t := f.pending[a]; t != nil && t.table != nil {
+			if isIdentifier(k.text) && strings.HasPrefix(k.text, "\"") {
+				t.table.entries = append(t.table.entries, k.text[1:len(k.text)-1]+" = "+v.String())
+			} else {
+				t.table.entries = append(t.table.entries, "["+k.String()+"] = "+v.String())
+			}
+			break
+		}
+		t := f.operand(a, pc).single()
+		f.flushAll()
+		f.emit("%s = %s", index(t, k), v)
+	case vm.OP_NEWTABLE:
+		f.assign(a, pc, &expr{table: &tableExpr{}, prec: precAtom})
+	case vm.OP_SELF:
+		obj := f.operand(b, pc).single()
+		k := f.rk(c, pc)
+		if isIdentifier(k.text) && strings.HasPrefix(k.text, "\"") && f.isTemp(a, pc) && f.isTemp(a+1, pc) && f.foldable(pc, a, a+1) {
+			f.clobber(a)
+			f.clobber(a + 1)
+			f.pending[a] = &expr{method: obj, name: k.text[1 : len(k.text)-1], prec: precAtom}
+			f.pending[a+1] = &expr{self: true}
+			f.uses[a] = f.reading
+			break
+		}
+		self, _ := f.targetName(a+1, pc)
+		if f.isTemp(a+1, pc) {
+			self = f.tempName(a + 1)
+		}
+		f.clobber(a + 1)
+		f.emit("%s = %s", self, obj)
+		f.assign(a, pc, index(name(self), k))
+	case vm.OP_ADD, vm.OP_SUB, vm.OP_MUL, vm.OP_MOD, vm.OP_POW, vm.OP_DIV, vm.OP_IDIV,
+		vm.OP_BAND, vm.OP_BOR, vm.OP_BXOR, vm.OP_SHL, vm.OP_SHR:
+		l, r := f.rk(b, pc), f.rk(c, pc)
+		f.assign(a, pc, binop(arithOps[op].op, arithOps[op].prec, l, r))
+	case vm.OP_UNM:
+		f.assign(a, pc, unary("-", f.operand(b, pc).single()))
+	case vm.OP_BNOT:
+		f.assign(a, pc, unary("~", f.operand(b, pc).single()))
+	case vm.OP_NOT:
+		f.assign(a, pc, unary("not", f.operand(b, pc).single()))
+	case vm.OP_LEN:
+		f.assign(a, pc, unary("#", f.operand(b, pc).single()))
+	case vm.OP_CONCAT:
+		var operands []*expr
+		for r := b; r <= c; r++ {
+			operands = append(operands, f.operand(r, pc).single())
+		}
+		e := operands[len(operands)-1]
+		for k := len(operands) - 2; k >= 0; k-- { // right associative
+			e = binop("..", precConcat, operands[k], e)
+		}
+		f.assign(a, pc, e)
+	case vm.OP_JMP:
+		f.flushAll()
+		f.emitGoto(pc + 1 + sbx)
+	case vm.OP_EQ, vm.OP_LT, vm.OP_LE, vm.OP_TEST, vm.OP_TESTSET:
+		cond := f.jumpCondition(pc)
+		f.flushAll()
+		if pc+1 >= len(f.p.Code) || f.p.Code[pc+1].Opcode() != vm.OP_JMP {
+			f.emit("-- malformed test")
+			break
+		}
+		_, jmp := f.p.Code[pc+1].AsBx()
+		f.emit("if %s then", cond)
+		f.indent++
+		if op == vm.OP_TESTSET { // under the name the other arm stores it
+			f.emit("%s = %s", f.regName(a, pc+2+jmp), f.testSetValue(b, pc))
+		}
+		f.emitGoto(pc + 2 + jmp)
+		f.indent--
+		f.emit("end")
+		if f.isJumpTarget(pc + 1) {
+			f.emitGoto(pc + 2)
+			return pc + 1
+		}
+		return pc + 2
+	case vm.OP_CALL:
+		call := f.call(a, b, pc)
+		switch {
+		case c == 1:
+			f.flushAll()
+			f.emit("%s", call.text)
+		case c == 2:
+			f.assign(a, pc, call)
+		case c == 0:
+			call.multi = true
+			f.clobber(a)
+			f.pending[a] = call
+			f.uses[a] = f.reading
+		default:
+			call.multi = true
+			f.assignMulti(a, c-1, pc, call)
+		}
+	case vm.OP_TAILCALL:
+		call := f.call(a, b, pc)
+		f.flushAll()
+		f.emit("return %s", call.text)
+		if pc+1 < len(f.p.Code) && f.p.Code[pc+1].Opcode() == vm.OP_RETURN && !f.isJumpTarget(pc+1) {
+			return pc + 2
+		}
+	case vm.OP_RETURN:
+		args := f.operands(a, b-1, pc)
+		f.flushAll()
+		if len(args) == 0 {
+			f.emit("return")
+		} else {
+			f.emit("return %s", strings.Join(args, ", "))
+		}
+	case vm.OP_FORPREP:
+		args := f.operands(a, 3, pc)
+		f.flushAll()
+		f.emit("%s, %s, %s = %s", f.tempName(a), f.tempName(a+1), f.tempName(a+2), strings.Join(args, ", "))
+		f.emit("%s = %s - %s", f.tempName(a), f.tempName(a), f.tempName(a+2))
+		f.emitGoto(pc + 1 + sbx)
+	case vm.OP_FORLOOP:
+		f.flushAll()
+		idx, limit, step := f.tempName(a), f.tempName(a+1), f.tempName(a+2)
+		f.emit("%s = %s + %s", idx, idx, step)
+		f.emit("if 0 < %s and %s <= %s or %s <= 0 and %s <= %s then", step, idx, limit, step, limit, idx)
+		f.indent++
+		f.emit("%s = %s", f.tempName(a+3), idx)
+		f.emitGoto(pc + 1 + sbx)
+		f.indent--
+		f.emit("end")
+	case vm.OP_TFORCALL:
+		args := f.operands(a, 3, pc)
+		f.flushAll()
+		var vars []string
+		for r := a + 3; r < a+3+c; r++ {
+			vars = append(vars, f.tempName(r))
+		}
+		if len(args) == 3 {
+			f.emit("%s = %s(%s, %s)", strings.Join(vars, ", "), exprOf(args[0]).asPrefix(), args[1], args[2])
+		} else {
+			f.emit("%s = %s", strings.Join(vars, ", "), strings.Join(args, ", "))
+		}
+	case vm.OP_TFORLOOP:
+		f.flushAll()
+		f.emit("if %s ~= nil then", f.tempName(a+1))
+		f.indent++
+		f.emit("%s = %s", f.tempName(a), f.tempName(a+1))
+		f.emitGoto(pc + 1 + sbx)
+		f.indent--
+		f.emit("end")
+	case vm.OP_SETLIST:
+		next := pc + 1
+		if c == 0 && pc+1 < len(f.p.Code) {
+			c = f.p.Code[pc+1].Ax()
+			next = pc + 2
+		}
+		n := b
+		if n == 0 {
+			n = -1
+		}
+		items := f.operands(a+1, n, pc)
+		if t := f.pending[a]; t != nil && t.table != nil {
+			t.table.entries = append(t.table.entries, items...)
+			return next
+		}
+		t := name(f.regName(a, pc))
+		f.flushAll()
+		for k, item := range items {
+			f.emit("%s[%d] = %s", t.asPrefix(), (c-1)*50+k+1, item)
+		}
+		return next
+	case vm.OP_CLOSURE:
+		f.reading = append(f.reading, f.reads(pc)...)
+		if t, decl := f.targetName(a, pc); decl && contains(f.reads(pc), a) { // local function
+			f.clobber(a)
+			f.declared[f.localAt(a, pc+1)] = true
+			e := f.closure(bx, pc, a, t)
+			f.emitDecl(t, "function %s%s", t, strings.TrimPrefix(e.text, "function"))
+			break
+		}
+		f.assign(a, pc, f.closure(bx, pc, -1, ""))
+	case vm.OP_VARARG:
+		e := &expr{text: "...", prec: precAtom, multi: true}
+		if b == 0 {
+			f.clobber(a)
+			f.pending[a] = e
+			f.uses[a] = nil
+		} else if b == 2 {
+			if f.isTemp(a, pc) && f.foldable(pc, a) {
+				e = e.single()
+			}
+			f.assign(a, pc, e) // a single target adjusts '...' by itself
+		} else if b > 2 {
+			f.assignMulti(a, b-1, pc, e)
+		}
+	case vm.OP_EXTRAARG:
+		// consumed by LOADKX and SETLIST
+	}
+	return pc + 1
+}
+
+/* source of TESTSET, which is both tested and copied; kept in a variable */
+func (f *function) testSetValue(b, pc int) *expr {
+	if e := f.pending[b]; e != nil {
+		f.flush(b)
+	}
+	return name(f.regName(b, pc))
+}
+
+func exprOf(s string) *expr {
+	if isIdentifier(s) {
+		return name(s)
+	}
+	return atom(s)
+}
+
+func (f *function) isTemp(r, pc int) bool {
+	t, decl := f.targetName(r, pc)
+	return !decl && t == fmt.Sprintf("r%d", r)
+}
+
+func (f *function) call(a, b, pc int) *expr {
+	fn := f.operand(a, pc)
+	n := b - 1
+	if fn.method != nil {
+		delete(f.pending, a+1)
+		if n > 0 {
+			n--
+		}
+		args := f.operands(a+2, n, pc)
+		return name(fmt.Sprintf("%s:%s(%s)", fn.method.asPrefix(), fn.name, strings.Join(args, ", ")))
+	}
+	args := f.operands(a+1, n, pc)
+	return name(fmt.Sprintf("%s(%s)", fn.single().asPrefix(), strings.Join(args, ", ")))
+}
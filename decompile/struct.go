@@ -0,0 +1,408 @@
+package decompile
+
+import (
+	"strings"
+
+	"github.com/uganh16/luago/vm"
+)
+
+/* emit the instructions in [from, to), recovering control structures where possible */
+func (f *function) emitRange(from, to int) {
+	for pc := from; pc < to; {
+		if f.isJumpTarget(pc) && !f.placed[pc] {
+			f.flushAll()
+			f.emitLabel(pc)
+		}
+		f.declareLocals(pc)
+		if next, ok := f.structure(pc, to); ok {
+			pc = next
+		} else {
+			pc = f.instruction(pc)
+		}
+	}
+}
+
+/* bind named locals that start at pc to the values already in their registers */
+func (f *function) declareLocals(pc int) {
+	if pc == 0 {
+		return // parameters
+	}
+	var names []string
+	first := -1
+	for i, locVar := range f.p.LocVars {
+		if int(locVar.StartPC) != pc || f.declared[i] || f.locNames[i] == "" {
+			continue
+		}
+		r := f.registerOf(i, pc)
+		if first < 0 {
+			first = r
+		} else if r != first+len(names) {
+			break
+		}
+		f.declared[i] = true
+		names = append(names, f.locNames[i])
+	}
+	if len(names) == 0 {
+		return
+	}
+	f.reading = nil
+	values := f.operands(first, len(names), pc)
+	for r := first; r < first+len(names); r++ {
+		f.clobber(r)
+	}
+	list := strings.Join(names, ", ")
+	f.emitDecl(list, "%s = %s", list, strings.Join(values, ", "))
+}
+
+/* register holding the i-th entry of LocVars at pc */
+func (f *function) registerOf(i, pc int) int {
+	n := 0
+	for j, locVar := range f.p.LocVars[:i] {
+		if int(locVar.StartPC) <= pc && pc < int(locVar.EndPC) && j < i {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *function) structure(pc, to int) (int, bool) {
+	if next, ok := f.loopStatement(pc, to); ok {
+		return next, true
+	}
+	i := f.p.Code[pc]
+	a, _, _ := i.ABC()
+	_, sbx := i.AsBx()
+	switch i.Opcode() {
+	case vm.OP_FORPREP:
+		q := pc + 1 + sbx
+		if q < pc+1 || q >= to || f.p.Code[q].Opcode() != vm.OP_FORLOOP || !f.closed(pc+1, q+1, pc) {
+			return 0, false
+		}
+		if qa, _, _ := f.p.Code[q].ABC(); qa != a {
+			return 0, false
+		}
+		f.reading = nil
+		args := f.operands(a, 3, pc)
+		f.flushAll()
+		if len(args) == 3 && args[2] == "1" {
+			args = args[:2]
+		}
+		f.emit("for %s = %s do", f.loopVar(a+3, pc+1), strings.Join(args, ", "))
+		f.loopBody(pc+1, q, q+1)
+		return q + 1, true
+	case vm.OP_JMP:
+		q := pc + 1 + sbx
+		if q > pc && q+1 < to && f.p.Code[q].Opcode() == vm.OP_TFORCALL &&
+			f.p.Code[q+1].Opcode() == vm.OP_TFORLOOP && f.closed(pc+1, q+2, pc) {
+			a, _, c := f.p.Code[q].ABC()
+			la, _, _ := f.p.Code[q+1].ABC()
+			_, back := f.p.Code[q+1].AsBx()
+			if la == a+2 && q+2+back == pc+1 {
+				f.reading = nil
+				args := f.operands(a, 3, pc)
+				f.flushAll()
+				var vars []string
+				for r := a + 3; r < a+3+c; r++ {
+					vars = append(vars, f.loopVar(r, pc+1))
+				}
+				f.emit("for %s in %s do", strings.Join(vars, ", "), strings.Join(args, ", "))
+				f.loopBody(pc+1, q, q+2)
+				return q + 2, true
+			}
+		}
+	case vm.OP_EQ, vm.OP_LT, vm.OP_LE, vm.OP_TEST:
+		if next, ok := f.ifStatement(pc, to); ok {
+			return next, true
+		}
+	case vm.OP_TESTSET:
+		if next, ok := f.shortCircuit(pc, to); ok {
+			return next, true
+		}
+	}
+	return f.loopStatement(pc, to)
+}
+
+/* 'a and b' or 'a or b' stored by the TESTSET at pc and the code up to where its jump joins */
+func (f *function) shortCircuit(pc, to int) (int, bool) {
+	if pc+1 >= to || f.p.Code[pc+1].Opcode() != vm.OP_JMP || f.isJumpTarget(pc+1) {
+		return 0, false
+	}
+	_, sbx := f.p.Code[pc+1].AsBx()
+	t := pc + 2 + sbx
+	if t <= pc+2 || t > to || t >= len(f.p.Code) {
+		return 0, false
+	}
+	for _, j := range f.jumps {
+		if j[1] == t && (j[0] < pc || j[0] >= t) {
+			return 0, false // the value also comes from elsewhere
+		}
+	}
+	if !f.closed(pc+2, t, pc) {
+		return 0, false
+	}
+
+	a, _, _ := f.p.Code[pc].ABC()
+	mark, saved := len(f.lines), f.save()
+	f.reading = nil
+	f.join = a
+	e := f.shortValue(pc, t)
+	f.join = -1
+	if e == nil || len(f.lines) != mark {
+		f.lines = f.lines[:mark]
+		f.restore(saved)
+		return 0, false
+	}
+	f.placed[t] = true // every jump to t has been folded away
+	if f.isTemp(a, t-1) && f.useFrom(t, f.g.BlockAt(t), a, false) >= 0 {
+		uses := f.reading
+		f.clobber(a)
+		f.pending[a] = e
+		f.uses[a] = uses
+	} else {
+		f.assign(a, t-1, e)
+	}
+	return t, true
+}
+
+/* value of the TESTSET at pc, whose jump goes to t; nil if [pc+2, t) is not a plain expression */
+func (f *function) shortValue(pc, t int) *expr {
+	a, b, c := f.p.Code[pc].ABC()
+	op, prec := "and", precAnd
+	if c != 0 {
+		op, prec = "or", precOr
+	}
+	l := f.operand(b, pc).single()
+	reads := f.reading
+	before := f.save()
+	for x := pc + 2; x < t; {
+		i := f.p.Code[x]
+		xa, _, xc := i.ABC()
+		switch i.Opcode() {
+		case vm.OP_TESTSET:
+			if _, xsbx := f.p.Code[x+1].AsBx(); xa != a || f.p.Code[x+1].Opcode() != vm.OP_JMP || x+2+xsbx != t {
+				return nil
+			}
+			f.reading = nil
+			r := f.shortValue(x, t)
+			if r == nil {
+				return nil
+			}
+			f.reading = append(reads, f.reading...)
+			return binop(op, prec, l, r)
+		case vm.OP_JMP, vm.OP_EQ, vm.OP_LT, vm.OP_LE, vm.OP_TEST, vm.OP_FORPREP, vm.OP_FORLOOP,
+			vm.OP_TFORCALL, vm.OP_TFORLOOP, vm.OP_RETURN, vm.OP_TAILCALL:
+			return nil
+		case vm.OP_LOADBOOL:
+			if xc != 0 {
+				return nil
+			}
+		}
+		x = f.instruction(x)
+		if x > t {
+			return nil
+		}
+	}
+	r := f.pending[a]
+	delete(f.pending, a)
+	if r == nil || len(f.pending) != len(before.pending) {
+		return nil
+	}
+	for x, e := range f.pending {
+		if before.pending[x] != e {
+			return nil // computed only on one path
+		}
+	}
+	f.reading = append(reads, f.uses[a]...)
+	return binop(op, prec, l, r)
+}
+
+func (f *function) loopVar(r, pc int) string {
+	if i := f.localAt(r, pc); i >= 0 && f.locNames[i] != "" {
+		f.declared[i] = true
+		return f.locNames[i]
+	}
+	return f.tempName(r)
+}
+
+/* body [from, to) of a loop whose continuation is at cont and exit at exit */
+func (f *function) loopBody(from, cont, exit int) {
+	f.loops = append(f.loops, loop{exit: exit})
+	f.indent++
+	f.emitRange(from, cont)
+	f.flushAll()
+	if f.isJumpTarget(cont) {
+		f.emitLabel(cont)
+	}
+	f.indent--
+	f.loops = f.loops[:len(f.loops)-1]
+	f.emit("end")
+}
+
+/* if/else around the test at pc and the jump that follows it */
+func (f *function) ifStatement(pc, to int) (int, bool) {
+	if pc+1 >= to || f.p.Code[pc+1].Opcode() != vm.OP_JMP || f.isJumpTarget(pc+1) {
+		return 0, false
+	}
+	_, sbx := f.p.Code[pc+1].AsBx()
+	e := pc + 2 + sbx
+	if e <= pc+2 || e > to {
+		return 0, false
+	}
+	for _, l := range f.loops {
+		if l.exit == e {
+			return 0, false // a conditional break
+		}
+	}
+
+	thenEnd, elseEnd := e, -1
+	if j := e - 1; j >= pc+2 && f.p.Code[j].Opcode() == vm.OP_JMP && !f.isJumpTarget(j) {
+		_, jsbx := f.p.Code[j].AsBx()
+		t := j + 1 + jsbx
+		isExit := len(f.loops) > 0 && f.loops[len(f.loops)-1].exit == t
+		if t > e && t <= to && !isExit && f.closed(e, t, pc+1) {
+			thenEnd, elseEnd = j, t
+		}
+	}
+	if !f.closed(pc+2, thenEnd, pc) {
+		return 0, false
+	}
+
+	f.reading = nil
+	cond := negate(f.jumpCondition(pc))
+	f.flushAll()
+	f.emit("if %s then", cond)
+	f.indent++
+	f.emitRange(pc+2, thenEnd)
+	f.flushAll()
+	f.indent--
+	if elseEnd < 0 {
+		f.emit("end")
+		return e, true
+	}
+	f.emit("else")
+	f.indent++
+	f.placed[e] = true // entered only from the test
+	mark := len(f.lines)
+	f.emitRange(e, elseEnd)
+	f.flushAll()
+	f.indent--
+	if !f.elseif(mark) {
+		f.emit("end")
+	}
+	return elseEnd, true
+}
+
+/* turn an else branch made of a single if statement, lines[mark:], into an elseif */
+func (f *function) elseif(mark int) bool {
+	body := f.lines[mark:]
+	inner := f.indent + 1
+	if len(body) < 2 || body[0].indent != inner || !strings.HasPrefix(body[0].text, "if ") || body[len(body)-1].text != "end" {
+		return false
+	}
+	ifs := 0
+	for _, l := range body {
+		if l.indent == inner && strings.HasPrefix(l.text, "if ") {
+			ifs++
+		}
+		if ifs > 1 || l.indent == inner && !(strings.HasPrefix(l.text, "if ") || strings.HasPrefix(l.text, "elseif ") ||
+			l.text == "else" || l.text == "end") || l.indent < inner || l.decl != "" && l.indent == inner {
+			return false
+		}
+	}
+	for i := range body {
+		body[i].indent--
+	}
+	f.lines[mark-1].text = "else" + body[0].text
+	f.lines = append(f.lines[:mark], body[1:]...)
+	return true
+}
+
+/* loop closed by a backward JMP to pc: while, repeat or an endless loop */
+func (f *function) loopStatement(pc, to int) (int, bool) {
+	j := -1
+	for x := pc + 1; x < to; x++ {
+		if f.p.Code[x].Opcode() == vm.OP_JMP {
+			if _, sbx := f.p.Code[x].AsBx(); x+1+sbx == pc {
+				j = x
+			}
+		}
+	}
+	if j < 0 || !f.closed(pc, j+1) {
+		return 0, false
+	}
+
+	// while: the block at pc computes a condition that exits the loop
+	if t := f.g.BlockAt(pc).End - 1; t+1 < j && f.isStructuredTest(t) && !f.isJumpTarget(t+1) {
+		if _, sbx := f.p.Code[t+1].AsBx(); t+2+sbx == j+1 {
+			mark, saved := len(f.lines), f.save()
+			for x := pc; x < t; {
+				f.declareLocals(x)
+				x = f.instruction(x)
+			}
+			f.reading = nil
+			cond := negate(f.jumpCondition(t))
+			if len(f.lines) == mark && len(f.pending) == 0 {
+				f.emit("while %s do", cond)
+				f.loopBody(t+2, j, j+1)
+				return j + 1, true
+			}
+			f.lines = f.lines[:mark]
+			f.restore(saved)
+		}
+	}
+
+	// repeat: the loop ends with a test that jumps back
+	if t := j - 1; t > pc && f.isStructuredTest(t) {
+		f.emit("repeat")
+		f.loops = append(f.loops, loop{exit: j + 1})
+		f.indent++
+		f.emitRange(pc, t)
+		f.reading = nil
+		cond := negate(f.jumpCondition(t))
+		f.flushAll()
+		f.indent--
+		f.loops = f.loops[:len(f.loops)-1]
+		f.emit("until %s", cond)
+		return j + 1, true
+	}
+
+	f.emit("while true do")
+	f.loopBody(pc, j, j+1)
+	return j + 1, true
+}
+
+func (f *function) isStructuredTest(pc int) bool {
+	switch f.p.Code[pc].Opcode() {
+	case vm.OP_EQ, vm.OP_LT, vm.OP_LE, vm.OP_TEST:
+		return pc+1 < len(f.p.Code) && f.p.Code[pc+1].Opcode() == vm.OP_JMP
+	}
+	return false
+}
+
+type snapshot struct {
+	pending  map[int]*expr
+	uses     map[int][]int
+	declared map[int]bool
+	labels   map[int]bool
+}
+
+func (f *function) save() snapshot {
+	s := snapshot{map[int]*expr{}, map[int][]int{}, map[int]bool{}, map[int]bool{}}
+	for k, v := range f.pending {
+		s.pending[k] = v
+	}
+	for k, v := range f.uses {
+		s.uses[k] = v
+	}
+	for k, v := range f.declared {
+		s.declared[k] = v
+	}
+	for k, v := range f.labels {
+		s.labels[k] = v
+	}
+	return s
+}
+
+func (f *function) restore(s snapshot) {
+	f.pending, f.uses, f.declared, f.labels = s.pending, s.uses, s.declared, s.labels
+}
@@ -0,0 +1,188 @@
+package diff
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/uganh16/luago/binary"
+)
+
+type Options struct {
+	IgnoreDebug bool // ignore source names, line info and local and upvalue names
+	Context     int  // lines of context around each change
+}
+
+/*
+ * write a unified-diff-style report of the changes from chunk a to chunk b,
+ * named aName and bName, and report whether they differ. Nested functions
+ * are matched by the line they are defined on, or by position when that is
+ * not known, and named by their path (main, main/0, ...).
+ */
+func Write(w io.Writer, aName, bName string, a, b *binary.Prototype, opts Options) (bool, error) {
+	bw := bufio.NewWriter(w)
+	d := &differ{w: bw, aName: aName, bName: bName, opts: opts}
+	d.function("main", "main", a, b)
+	return d.changed, bw.Flush()
+}
+
+type differ struct {
+	w            *bufio.Writer
+	aName, bName string
+	opts         Options
+	changed      bool
+}
+
+/* start of the report, written before the first change */
+func (d *differ) begin() {
+	if !d.changed {
+		fmt.Fprintf(d.w, "--- %s\n+++ %s\n", d.aName, d.bName)
+		d.changed = true
+	}
+}
+
+func (d *differ) section(title string, a, b []string) {
+	if !equal(a, b) {
+		d.begin()
+		writeHunks(d.w, title, a, b, d.opts.Context)
+	}
+}
+
+func (d *differ) function(aPath, bPath string, a, b *binary.Prototype) {
+	path := aPath
+	if aPath != bPath {
+		path = aPath + " -> " + bPath
+	}
+	d.section(path+" header", d.header(a), d.header(b))
+	d.section(path+" constants", constants(a), constants(b))
+	d.section(path+" upvalues", d.upvalues(a), d.upvalues(b))
+	d.section(path+" code", d.code(a), d.code(b))
+	if !d.opts.IgnoreDebug {
+		d.section(path+" locals", locals(a), locals(b))
+	}
+
+	for _, m := range d.align(a.Protos, b.Protos) {
+		switch {
+		case m[0] < 0:
+			d.begin()
+			fmt.Fprintf(d.w, "@@ %s/%d added @@\n", bPath, m[1])
+		case m[1] < 0:
+			d.begin()
+			fmt.Fprintf(d.w, "@@ %s/%d removed @@\n", aPath, m[0])
+		default:
+			d.function(fmt.Sprintf("%s/%d", aPath, m[0]), fmt.Sprintf("%s/%d", bPath, m[1]), a.Protos[m[0]], b.Protos[m[1]])
+		}
+	}
+}
+
+/* pairs of indices of matching functions in a and b; -1 stands for a missing one */
+func (d *differ) align(a, b []*binary.Prototype) [][2]int {
+	byLine := !d.opts.IgnoreDebug
+	for _, p := range append(append([]*binary.Prototype{}, a...), b...) {
+		byLine = byLine && p.LineDefined != 0
+	}
+	if !byLine {
+		var pairs [][2]int
+		for i := 0; i < len(a) || i < len(b); i++ {
+			switch {
+			case i >= len(a):
+				pairs = append(pairs, [2]int{-1, i})
+			case i >= len(b):
+				pairs = append(pairs, [2]int{i, -1})
+			default:
+				pairs = append(pairs, [2]int{i, i})
+			}
+		}
+		return pairs
+	}
+
+	keys := func(protos []*binary.Prototype) []string {
+		var lines []string
+		for _, p := range protos {
+			lines = append(lines, fmt.Sprintf("%d", p.LineDefined))
+		}
+		return lines
+	}
+	var pairs [][2]int
+	for _, e := range lcs(keys(a), keys(b)) {
+		switch e.kind {
+		case same:
+			pairs = append(pairs, [2]int{e.a, e.b})
+		case del:
+			pairs = append(pairs, [2]int{e.a, -1})
+		case ins:
+			pairs = append(pairs, [2]int{-1, e.b})
+		}
+	}
+	return pairs
+}
+
+func (d *differ) header(p *binary.Prototype) []string {
+	lines := []string{
+		fmt.Sprintf("params %d", p.NumParams),
+		fmt.Sprintf("vararg %t", p.IsVararg),
+		fmt.Sprintf("maxstacksize %d", p.MaxStackSize),
+	}
+	if !d.opts.IgnoreDebug {
+		lines = append(lines,
+			fmt.Sprintf("source %q", p.Source),
+			fmt.Sprintf("lines %d,%d", p.LineDefined, p.LastLineDefined))
+	}
+	return lines
+}
+
+func constants(p *binary.Prototype) []string {
+	var lines []string
+	for _, k := range p.Constants {
+		lines = append(lines, binary.ConstantString(k))
+	}
+	return lines
+}
+
+func (d *differ) upvalues(p *binary.Prototype) []string {
+	var lines []string
+	for i, upvalue := range p.Upvalues {
+		line := fmt.Sprintf("%d %d", upvalue.InStack, upvalue.Idx)
+		if !d.opts.IgnoreDebug && i < len(p.UpvalueNames) {
+			line += " " + p.UpvalueNames[i]
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (d *differ) code(p *binary.Prototype) []string {
+	var lines []string
+	for pc, i := range p.Code {
+		line := i.String()
+		if !d.opts.IgnoreDebug {
+			if pc < len(p.LineInfo) {
+				line = fmt.Sprintf("[%d] %s", p.LineInfo[pc], line)
+			} else {
+				line = "[-] " + line
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func locals(p *binary.Prototype) []string {
+	var lines []string
+	for _, locVar := range p.LocVars {
+		lines = append(lines, fmt.Sprintf("%s %d %d", locVar.VarName, locVar.StartPC+1, locVar.EndPC+1))
+	}
+	return lines
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
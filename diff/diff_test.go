@@ -0,0 +1,69 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/uganh16/luago/binary"
+	"github.com/uganh16/luago/vm"
+)
+
+func proto(line uint32, code ...vm.Instruction) *binary.Prototype {
+	lines := make([]uint32, len(code))
+	for i := range lines {
+		lines[i] = line + uint32(i)
+	}
+	return &binary.Prototype{LineDefined: line, LastLineDefined: line + uint32(len(code)), Code: code, LineInfo: lines}
+}
+
+func write(t *testing.T, a, b *binary.Prototype, opts Options) (string, bool) {
+	t.Helper()
+	var sb strings.Builder
+	changed, err := Write(&sb, "a", "b", a, b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sb.String(), changed
+}
+
+func TestCode(t *testing.T) {
+	ret := vm.CreateABC(vm.OP_RETURN, 0, 1, 0)
+	a := proto(0, vm.CreateABx(vm.OP_LOADK, 0, 0), vm.CreateABC(vm.OP_MOVE, 1, 0, 0), ret)
+	b := proto(0, vm.CreateABx(vm.OP_LOADK, 0, 0), vm.CreateABx(vm.OP_LOADK, 1, 0), ret)
+
+	got, changed := write(t, a, b, Options{IgnoreDebug: true, Context: 1})
+	want := "--- a\n+++ b\n" +
+		"@@ -1,3 +1,3 @@ main code\n" +
+		" LOADK 0 -1\n" +
+		"-MOVE 1 0\n" +
+		"+LOADK 1 -1\n" +
+		" RETURN 0 1\n"
+	if !changed || got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if got, changed := write(t, a, a, Options{}); changed || got != "" {
+		t.Errorf("identical chunks reported as different:\n%s", got)
+	}
+}
+
+func TestAlign(t *testing.T) {
+	ret := vm.CreateABC(vm.OP_RETURN, 0, 1, 0)
+	f, g, h := proto(1, ret), proto(5, ret), proto(9, ret)
+	a := proto(0, ret)
+	a.Protos = []*binary.Prototype{f, h}
+	b := proto(0, ret)
+	b.Protos = []*binary.Prototype{f, g, h}
+
+	got, _ := write(t, a, b, Options{})
+	want := "--- a\n+++ b\n@@ main/1 added @@\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// by position, the second function changed and the third is new
+	got, _ = write(t, a, b, Options{IgnoreDebug: true})
+	if !strings.Contains(got, "@@ main/2 added @@\n") || strings.Contains(got, "main/1 added") {
+		t.Errorf("unexpected alignment by position:\n%s", got)
+	}
+}
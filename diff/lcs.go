@@ -0,0 +1,122 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+)
+
+type opKind byte
+
+const (
+	same opKind = ' '
+	del  opKind = '-'
+	ins  opKind = '+'
+)
+
+type edit struct {
+	kind opKind
+	a, b int // line indices in a and b; for an insertion or deletion, a or b is that of the next line
+}
+
+/* shortest edit script turning a into b, from their longest common subsequence */
+func lcs(a, b []string) []edit {
+	n, m := len(a), len(b)
+	// l[i][j] is the length of the LCS of a[i:] and b[j:]
+	l := make([][]int, n+1)
+	for i := range l {
+		l[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				l[i][j] = l[i+1][j+1] + 1
+			} else if l[i+1][j] >= l[i][j+1] {
+				l[i][j] = l[i+1][j]
+			} else {
+				l[i][j] = l[i][j+1]
+			}
+		}
+	}
+
+	var edits []edit
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && a[i] == b[j]:
+			edits = append(edits, edit{same, i, j})
+			i++
+			j++
+		case j == m || i < n && l[i+1][j] >= l[i][j+1]:
+			edits = append(edits, edit{del, i, j})
+			i++
+		default:
+			edits = append(edits, edit{ins, i, j})
+			j++
+		}
+	}
+	return edits
+}
+
+/* write the changes from a to b as unified diff hunks titled title; reports whether there were any */
+func writeHunks(w io.Writer, title string, a, b []string, context int) bool {
+	edits := lcs(a, b)
+	changed := false
+	for start := 0; start < len(edits); {
+		// find the next change and extend the hunk while changes are close enough
+		first := start
+		for first < len(edits) && edits[first].kind == same {
+			first++
+		}
+		if first == len(edits) {
+			break
+		}
+		changed = true
+		last := first
+		for k := first; k < len(edits); k++ {
+			if edits[k].kind != same {
+				last = k
+			} else if k-last > 2*context {
+				break
+			}
+		}
+		from, to := first-context, last+context+1
+		if from < start {
+			from = start
+		}
+		if to > len(edits) {
+			to = len(edits)
+		}
+
+		aStart, bStart := edits[from].a, edits[from].b
+		aLen, bLen := 0, 0
+		for _, e := range edits[from:to] {
+			if e.kind != ins {
+				aLen++
+			}
+			if e.kind != del {
+				bLen++
+			}
+		}
+		fmt.Fprintf(w, "@@ -%s +%s @@ %s\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen), title)
+		for _, e := range edits[from:to] {
+			switch e.kind {
+			case same, del:
+				fmt.Fprintf(w, "%c%s\n", e.kind, a[e.a])
+			case ins:
+				fmt.Fprintf(w, "%c%s\n", e.kind, b[e.b])
+			}
+		}
+		start = to
+	}
+	return changed
+}
+
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if n == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
@@ -2,146 +2,389 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/uganh16/luago/binary"
+	"github.com/uganh16/luago/cfg"
+	"github.com/uganh16/luago/decompile"
+	"github.com/uganh16/luago/diff"
+	"github.com/uganh16/luago/optimize"
+	"github.com/uganh16/luago/sourcemap"
+	"github.com/uganh16/luago/stats"
 	"github.com/uganh16/luago/vm"
 )
 
-func main() {
-	for _, file := range os.Args[1:] {
-		var p *binary.Prototype
-		f, err := os.Open(file)
-		if err == nil {
-			p, err = binary.Undump(f)
-			f.Close()
-		}
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
-			continue
-		}
-		list(p)
-	}
+const (
+	PROGNAME      = "luac"            // default program name
+	OUTPUT        = PROGNAME + ".out" // default output file
+	LUA_COPYRIGHT = "Lua 5.3 (luago)"
+)
+
+var (
+	listing      = 0        // list bytecodes?
+	annotating   = false    // annotate listed bytecodes?
+	interleaving = false    // list source lines next to bytecodes?
+	sourceFile   = ""       // source file to interleave (default from chunk)
+	dumping      = true     // dump bytecodes?
+	stripping    = false    // strip debug information?
+	stripWhat    = 0        // parts of debug information to strip
+	optimizing   = false    // optimize bytecodes?
+	deduping     = false    // remove duplicate constants?
+	mapFile      = ""       // source map to attach to loaded chunks
+	writeMapFile = ""       // source map to write for the output chunk
+	output       = OUTPUT   // actual output file name
+	progname     = PROGNAME // actual program name
+	format       = "text"   // listing format
+	diffing      = false    // compare two chunks?
+	ignoreDebug  = false    // ignore debug information when comparing?
+	statistics   = false    // report statistics?
+)
+
+var interned = binary.StringTable{} // strings shared by all loaded chunks
+
+var stripParts = map[string]int{
+	"source":   binary.STRIP_SOURCE,
+	"lines":    binary.STRIP_LINEINFO,
+	"locals":   binary.STRIP_LOCVARS,
+	"upvalues": binary.STRIP_UPVALUENAMES,
 }
 
-func list(p *binary.Prototype) {
-	printHeader(p)
-	printCode(p)
-	printDebug(p)
-	for _, p := range p.Protos {
-		list(p)
-	}
+func fatal(message string) {
+	fmt.Fprintf(os.Stderr, "%s: %s\n", progname, message)
+	os.Exit(1)
 }
 
-func printHeader(p *binary.Prototype) {
-	funcType := "main"
-	if p.LineDefined > 0 {
-		funcType = "function"
-	}
+func cannot(what string, err error) {
+	fmt.Fprintf(os.Stderr, "%s: cannot %s %s: %v\n", progname, what, output, err)
+	os.Exit(1)
+}
 
-	source := p.Source
-	if source == "" {
-		source = "=?"
-	}
-	if source[0] == '@' || source[0] == '=' {
-		source = source[1:]
-	} else if source[0] == binary.LUA_SIGNATURE[0] {
-		source = "(bstring)"
+func usage(message string) {
+	if message[0] == '-' {
+		fmt.Fprintf(os.Stderr, "%s: unrecognized option '%s'\n", progname, message)
 	} else {
-		source = "(string)"
+		fmt.Fprintf(os.Stderr, "%s: %s\n", progname, message)
 	}
-
-	varargFlag := ""
-	if p.IsVararg {
-		varargFlag = "+"
-	}
-
-	fmt.Printf("\n%s <%s:%d,%d> (%d instruction%s)\n", funcType, source, p.LineDefined, p.LastLineDefined, len(p.Code), ss(len(p.Code)))
-	fmt.Printf("%d%s param%s, %d slot%s, %d upvalue%s, %d local%s, %d constant%s, %d function%s\n", p.NumParams, varargFlag, ss(int(p.NumParams)), p.MaxStackSize, ss(int(p.MaxStackSize)), len(p.Upvalues), ss(len(p.Upvalues)), len(p.LocVars), ss(len(p.LocVars)), len(p.Constants), ss(len(p.Constants)), len(p.Protos), ss(len(p.Protos)))
+	fmt.Fprintf(os.Stderr,
+		"usage: %s [options] [filenames]\n"+
+			"Available options are:\n"+
+			"  -l       list (use -l -l for full listing)\n"+
+			"  -a       annotate listing with constants, names and targets\n"+
+			"  -S       interleave listing with source lines\n"+
+			"  -o name  output to file 'name' (default is \"%s\")\n"+
+			"  -O       optimize bytecodes\n"+
+			"  --dedup  remove duplicate constants and report the bytes saved\n"+
+			"  -p       parse only\n"+
+			"  -s       strip debug information\n"+
+			"  --strip=parts strip only 'parts' of debug information, a comma-separated\n"+
+			"                list of source, lines, locals and upvalues\n"+
+			"  --write-map=name  save debug information to source map 'name'\n"+
+			"  --map=name    restore debug information from source map 'name'\n"+
+			"  -v       show version information\n"+
+			"  --format=fmt  list in format 'fmt' (text, json, dot or lua)\n"+
+			"                or report statistics in format 'fmt' (text or csv)\n"+
+			"  --source=name interleave listing with lines of file 'name'\n"+
+			"  --diff   compare two chunks instead of compiling them\n"+
+			"  --ignore-debug  ignore debug information when comparing\n"+
+			"  --stats  report statistics on chunks, searching directories\n"+
+			"  --       stop handling options\n"+
+			"  -        stop handling options and process stdin\n",
+		progname, OUTPUT)
+	os.Exit(1)
 }
 
-func printCode(p *binary.Prototype) {
-	for pc, i := range p.Code {
-		line := "-"
-		if len(p.LineInfo) > pc {
-			line = fmt.Sprintf("%d", p.LineInfo[pc])
-		}
-		fmt.Printf("\t%d\t[%s]\t%-9s\t", pc+1, line, i.OpName())
-		switch i.OpMode() {
-		case vm.IABC:
-			a, b, c := i.ABC()
-			fmt.Printf("%d", a)
-			if i.BMode() != vm.OpArgN {
-				if b > 0xff {
-					fmt.Printf(" %d", -1-(b&0xff))
-				} else {
-					fmt.Printf(" %d", b)
-				}
+func doargs(args []string) []string {
+	version := 0
+	if len(args) > 0 && args[0] != "" {
+		progname = args[0]
+	}
+	i := 1
+	for ; i < len(args); i++ {
+		arg := args[i]
+		if arg == "" || arg[0] != '-' { // end of options; keep it
+			break
+		} else if arg == "--" { // end of options; skip it
+			i++
+			if version > 0 {
+				version++
 			}
-			if i.CMode() != vm.OpArgN {
-				if c > 0xff {
-					fmt.Printf(" %d", -1-(c&0xff))
-				} else {
-					fmt.Printf(" %d", c)
+			break
+		} else if arg == "-" { // end of options; use stdin
+			break
+		} else if arg == "-l" { // list
+			listing++
+		} else if arg == "-a" { // annotate listing
+			annotating = true
+		} else if arg == "-S" { // interleave source
+			interleaving = true
+		} else if strings.HasPrefix(arg, "--source=") { // interleave given source
+			interleaving = true
+			sourceFile = arg[len("--source="):]
+		} else if arg == "-o" { // output file
+			i++
+			if i == len(args) || args[i] == "" || (args[i][0] == '-' && args[i] != "-") {
+				usage("'-o' needs argument")
+			}
+			output = args[i]
+		} else if arg == "-O" { // optimize
+			optimizing = true
+		} else if arg == "--dedup" { // remove duplicate constants
+			deduping = true
+		} else if arg == "-p" { // parse only
+			dumping = false
+		} else if arg == "-s" { // strip debug information
+			stripping = true
+		} else if strings.HasPrefix(arg, "--strip=") { // strip parts of debug information
+			for _, part := range strings.Split(arg[len("--strip="):], ",") {
+				what, ok := stripParts[part]
+				if !ok {
+					usage("unknown debug information '" + part + "'")
 				}
+				stripWhat |= what
+			}
+		} else if strings.HasPrefix(arg, "--write-map=") { // save debug information
+			writeMapFile = arg[len("--write-map="):]
+		} else if strings.HasPrefix(arg, "--map=") { // restore debug information
+			mapFile = arg[len("--map="):]
+		} else if arg == "-v" { // show version
+			version++
+		} else if strings.HasPrefix(arg, "--format=") { // listing format
+			format = arg[len("--format="):]
+			if format != "text" && format != "json" && format != "dot" && format != "lua" && format != "csv" {
+				usage("unknown format '" + format + "'")
 			}
-		case vm.IABx:
-			a, bx := i.ABx()
-			fmt.Printf("%d", a)
-			switch i.BMode() {
-			case vm.OpArgK:
-				fmt.Printf(" %d", -1-bx)
-			case vm.OpArgU:
-				fmt.Printf(" %d", bx)
+			if listing == 0 {
+				listing++
 			}
-		case vm.IAsBx:
-			a, sbx := i.AsBx()
-			fmt.Printf("%d %d", a, sbx)
-		case vm.IAx:
-			ax := i.Ax()
-			fmt.Printf("%d", -1-ax)
+		} else if arg == "--diff" { // compare chunks
+			diffing = true
+			dumping = false
+		} else if arg == "--ignore-debug" { // compare without debug information
+			ignoreDebug = true
+		} else if arg == "--stats" { // report statistics
+			statistics = true
+			dumping = false
+		} else { // unknown option
+			usage(arg)
+		}
+	}
+	if format == "csv" && !statistics {
+		usage("format 'csv' needs '--stats'")
+	}
+	files := args[i:]
+	if len(files) == 0 && (listing > 0 || !dumping) {
+		dumping = false
+		files = []string{OUTPUT}
+	}
+	if version > 0 {
+		fmt.Println(LUA_COPYRIGHT)
+		if version == len(args)-1 {
+			os.Exit(0)
 		}
-		fmt.Printf("\n")
 	}
+	return files
 }
 
-func printDebug(p *binary.Prototype) {
-	fmt.Printf("constants (%d):\n", len(p.Constants))
-	for i, k := range p.Constants {
-		s := "?"
-		switch k.(type) {
-		case nil:
-			s = "nil"
-		case bool:
-			s = fmt.Sprintf("%t", k)
-		case int64:
-			s = fmt.Sprintf("%d", k)
-		case float64:
-			s = fmt.Sprintf("%g", k)
-		case string:
-			s = fmt.Sprintf("%q", k)
+func load(file string) *binary.Prototype {
+	var p *binary.Prototype
+	var err error
+	if file == "-" {
+		file = "stdin"
+		p, err = binary.UndumpInterned(os.Stdin, interned)
+	} else {
+		var f *os.File
+		f, err = os.Open(file)
+		if err != nil {
+			fatal(fmt.Sprintf("cannot open %s", file))
 		}
-		fmt.Printf("\t%d\t%s\n", i+1, s)
+		p, err = binary.UndumpInterned(f, interned)
+		f.Close()
 	}
+	if err != nil {
+		fatal(fmt.Sprintf("%s: %v", file, err))
+	}
+	return p
+}
 
-	fmt.Printf("locals (%d):\n", len(p.LocVars))
-	for i, locVar := range p.LocVars {
-		fmt.Printf("\t%d\t%s\t%d\t%d\n", i, locVar.VarName, locVar.StartPC+1, locVar.EndPC+1)
+/* the given files, with directories replaced by the chunks found in them */
+func chunks(files []string) []string {
+	var res []string
+	for _, file := range files {
+		if info, err := os.Stat(file); err != nil || !info.IsDir() {
+			res = append(res, file)
+			continue
+		}
+		err := filepath.Walk(file, func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() && isChunk(path) {
+				res = append(res, path)
+			}
+			return err
+		})
+		if err != nil {
+			fatal(err.Error())
+		}
 	}
+	return res
+}
+
+/* whether file starts with the signature of precompiled chunks */
+func isChunk(file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	signature := make([]byte, len(binary.LUA_SIGNATURE))
+	_, err = io.ReadFull(f, signature)
+	return err == nil && string(signature) == binary.LUA_SIGNATURE
+}
 
-	fmt.Printf("upvalues (%d):\n", len(p.Upvalues))
-	for i, upvalue := range p.Upvalues {
-		upvalueName := "-"
-		if len(p.UpvalueNames) > 0 {
-			upvalueName = p.UpvalueNames[i]
+/* restore the debug information of f from mapFile */
+func attachMap(f *binary.Prototype) {
+	r, err := os.Open(mapFile)
+	if err != nil {
+		fatal(fmt.Sprintf("cannot open %s", mapFile))
+	}
+	defer r.Close()
+	m, err := sourcemap.Read(r)
+	if err != nil {
+		fatal(fmt.Sprintf("%s: %v", mapFile, err))
+	}
+	if m.Attach(f) == 0 {
+		fatal(fmt.Sprintf("%s: no function matches the chunk", mapFile))
+	}
+}
+
+/* save the debug information of f to writeMapFile */
+func writeMap(f *binary.Prototype) {
+	w, err := os.Create(writeMapFile)
+	if err == nil {
+		err = sourcemap.Extract(f).Write(w)
+		if cerr := w.Close(); err == nil {
+			err = cerr
 		}
-		fmt.Printf("\t%d\t%s\t%d\t%d\n", i, upvalueName, upvalue.InStack, upvalue.Idx)
+	}
+	if err != nil {
+		fatal(fmt.Sprintf("cannot write %s: %v", writeMapFile, err))
 	}
 }
 
-func ss(n int) string {
-	if n != 1 {
-		return "s"
+/* build a main function that calls each chunk in turn, as luac does */
+func combine(protos []*binary.Prototype) *binary.Prototype {
+	if len(protos) == 1 {
+		return protos[0]
+	}
+	/*
+	 * what luac gets by compiling "(function()end)();" once per chunk:
+	 * registers 0 and 1 are always valid, and it clears the line info
+	 * (f->sizelineinfo=0), so the main function has none
+	 */
+	f := &binary.Prototype{
+		Source:       "=(" + PROGNAME + ")",
+		IsVararg:     true,
+		MaxStackSize: 2,
+		Upvalues:     []binary.Upvalue{{InStack: 1, Idx: 0}}, // _ENV
+		Protos:       protos,
+		UpvalueNames: []string{"_ENV"},
+	}
+	for i, p := range protos {
+		if len(p.Upvalues) > 0 {
+			p.Upvalues[0].InStack = 0 // _ENV comes from the main function
+		}
+		f.Code = append(f.Code, vm.CreateABx(vm.OP_CLOSURE, 0, i), vm.CreateABC(vm.OP_CALL, 0, 1, 1))
+	}
+	f.Code = append(f.Code, vm.CreateABC(vm.OP_RETURN, 0, 1, 0))
+	return f
+}
+
+func main() {
+	files := doargs(os.Args)
+	if len(files) == 0 {
+		usage("no input files given")
+	}
+	if diffing {
+		if len(files) != 2 {
+			usage("'--diff' needs two input files")
+		}
+		opts := diff.Options{IgnoreDebug: ignoreDebug, Context: 3}
+		changed, err := diff.Write(os.Stdout, files[0], files[1], load(files[0]), load(files[1]), opts)
+		if err != nil {
+			fatal(err.Error())
+		}
+		if changed {
+			os.Exit(1)
+		}
+		return
+	}
+	if statistics {
+		report := &stats.Report{}
+		for _, file := range chunks(files) {
+			report.Add(file, load(file))
+		}
+		var err error
+		if format == "csv" {
+			err = report.WriteCSV(os.Stdout)
+		} else {
+			err = report.WriteText(os.Stdout)
+		}
+		if err != nil {
+			fatal(err.Error())
+		}
+		return
+	}
+	protos := make([]*binary.Prototype, len(files))
+	for i, file := range files {
+		protos[i] = load(file)
+	}
+	f := combine(protos)
+	if mapFile != "" {
+		attachMap(f)
+	}
+	if optimizing {
+		if _, err := optimize.Optimize(f); err != nil {
+			fatal(err.Error())
+		}
+	}
+	if deduping {
+		removed, saved := optimize.Dedup(f)
+		fmt.Fprintf(os.Stderr, "%s: %d duplicate constant%s removed, %d bytes saved\n", progname, removed, ss(removed), saved)
+	}
+	if listing > 0 {
+		var err error
+		switch format {
+		case "json":
+			err = binary.EncodeJSON(os.Stdout, f)
+		case "dot":
+			err = cfg.WriteDOT(os.Stdout, f)
+		case "lua":
+			err = decompile.Decompile(os.Stdout, f)
+		default:
+			printFunction(f, listing > 1, sourceFiles{})
+		}
+		if err != nil {
+			fatal(err.Error())
+		}
+	}
+	if dumping {
+		w := os.Stdout
+		if output != "-" {
+			var err error
+			if w, err = os.Create(output); err != nil {
+				cannot("open", err)
+			}
+		}
+		if writeMapFile != "" {
+			writeMap(f)
+		}
+		binary.Strip(f, stripWhat)
+		if err := binary.Dump(w, f, stripping); err != nil {
+			cannot("write", err)
+		}
+		if err := w.Close(); err != nil {
+			cannot("close", err)
+		}
 	}
-	return ""
 }
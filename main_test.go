@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/uganh16/luago/binary"
+	"github.com/uganh16/luago/vm"
+)
+
+func TestCombine(t *testing.T) {
+	ret := vm.CreateABC(vm.OP_RETURN, 0, 1, 0)
+	a := &binary.Prototype{Code: []vm.Instruction{ret}, Upvalues: []binary.Upvalue{{InStack: 1, Idx: 0}}}
+	b := &binary.Prototype{Code: []vm.Instruction{ret}}
+	if combine([]*binary.Prototype{a}) != a {
+		t.Errorf("a single chunk was not used as is")
+	}
+
+	f := combine([]*binary.Prototype{a, b})
+	want := []vm.Instruction{
+		vm.CreateABx(vm.OP_CLOSURE, 0, 0), vm.CreateABC(vm.OP_CALL, 0, 1, 1),
+		vm.CreateABx(vm.OP_CLOSURE, 0, 1), vm.CreateABC(vm.OP_CALL, 0, 1, 1),
+		ret,
+	}
+	if len(f.Code) != len(want) {
+		t.Fatalf("got %d instructions, want %d", len(f.Code), len(want))
+	}
+	for pc, i := range want {
+		if f.Code[pc] != i {
+			t.Errorf("[%d] got %s, want %s", pc+1, f.Code[pc], i)
+		}
+	}
+	if f.Source != "=(luac)" || f.MaxStackSize != 2 || !f.IsVararg || len(f.LineInfo) != 0 {
+		t.Errorf("main function differs from luac's: %+v", f)
+	}
+	if a.Upvalues[0].InStack != 0 {
+		t.Errorf("_ENV of a combined chunk still in the stack")
+	}
+}
+
+func TestLoadStdin(t *testing.T) {
+	ret := vm.CreateABC(vm.OP_RETURN, 0, 1, 0)
+	p := &binary.Prototype{Source: "=stdin", MaxStackSize: 2, Code: make([]vm.Instruction, 1<<18)}
+	for pc := range p.Code {
+		p.Code[pc] = ret
+	}
+	var chunk bytes.Buffer
+	if err := binary.Dump(&chunk, p, true); err != nil {
+		t.Fatal(err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	go func() { // far more than the pipe holds, so reads come back short
+		w.Write(chunk.Bytes())
+		w.Close()
+	}()
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+	if q := load("-"); len(q.Code) != len(p.Code) {
+		t.Errorf("loaded %d instructions, want %d", len(q.Code), len(p.Code))
+	}
+}
+
+/* what f prints to standard output */
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	f()
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestInterleavedListing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.lua")
+	src := "local x = 1\r\nlocal function f()\r\n  return x\r\nend\r\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	inner := &binary.Prototype{Source: "@" + path, LineDefined: 2, LastLineDefined: 4, MaxStackSize: 2,
+		Code: []vm.Instruction{
+			vm.CreateABC(vm.OP_GETUPVAL, 0, 0, 0),
+			vm.CreateABC(vm.OP_RETURN, 0, 2, 0),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		LineInfo: []uint32{3, 3, 4},
+		Upvalues: []binary.Upvalue{{InStack: 1, Idx: 0}},
+	}
+	main := &binary.Prototype{Source: "@" + path, IsVararg: true, MaxStackSize: 2,
+		Code: []vm.Instruction{
+			vm.CreateABx(vm.OP_LOADK, 0, 0),
+			vm.CreateABx(vm.OP_CLOSURE, 1, 0),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		Constants: []interface{}{int64(1)},
+		LineInfo:  []uint32{1, 4, 4},
+		Upvalues:  []binary.Upvalue{{InStack: 1, Idx: 0}},
+		Protos:    []*binary.Prototype{inner},
+	}
+
+	interleaving = true
+	defer func() { interleaving = false }()
+	got := captureStdout(t, func() { printFunction(main, false, sourceFiles{}) })
+	want := "\nmain <" + path + ":0,0> (3 instructions)\n" +
+		"0+ params, 2 slots, 1 upvalue, 0 locals, 1 constant, 1 function\n" +
+		"--   1: local x = 1\n" +
+		"\t1\t[1]\tLOADK    \t0 -1\n" +
+		"--   2: local function f()\n" +
+		"--   3:   return x\n" +
+		"--   4: end\n" +
+		"\t2\t[4]\tCLOSURE  \t1 0\n" +
+		"\t3\t[4]\tRETURN   \t0 1\n" +
+		"\nfunction <" + path + ":2,4> (3 instructions)\n" +
+		"0 params, 2 slots, 1 upvalue, 0 locals, 0 constants, 0 functions\n" +
+		"--   2: local function f()\n" +
+		"--   3:   return x\n" +
+		"\t1\t[3]\tGETUPVAL \t0 0\n" +
+		"\t2\t[3]\tRETURN   \t0 2\n" +
+		"--   4: end\n" +
+		"\t3\t[4]\tRETURN   \t0 1\n"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestAnnotatedListing(t *testing.T) {
+	inner := &binary.Prototype{Source: "@f.lua", LineDefined: 3, LastLineDefined: 5, MaxStackSize: 2,
+		Code: []vm.Instruction{
+			vm.CreateABC(vm.OP_GETUPVAL, 0, 0, 0),
+			vm.CreateABC(vm.OP_SETUPVAL, 0, 0, 0),
+			vm.CreateABC(vm.OP_NEWTABLE, 0, 0, 0),
+			vm.CreateABC(vm.OP_SETLIST, 0, 0, 0),
+			vm.CreateAx(vm.OP_EXTRAARG, 51),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		LineInfo:     []uint32{4, 4, 4, 4, 4, 5},
+		Upvalues:     []binary.Upvalue{{InStack: 1, Idx: 0}},
+		UpvalueNames: []string{"s"},
+	}
+	main := &binary.Prototype{Source: "@f.lua", IsVararg: true, MaxStackSize: 4,
+		Code: []vm.Instruction{
+			vm.CreateABx(vm.OP_LOADK, 0, 1),
+			vm.CreateABC(vm.OP_GETTABUP, 1, 0, 0x100),
+			vm.CreateABC(vm.OP_MOVE, 2, 0, 0),
+			vm.CreateABC(vm.OP_CALL, 1, 2, 1),
+			vm.CreateABC(vm.OP_ADD, 1, 0, 0x102),
+			vm.CreateABC(vm.OP_EQ, 1, 0, 0x103),
+			vm.CreateAsBx(vm.OP_JMP, 0, 1),
+			vm.CreateABC(vm.OP_SETTABUP, 0, 0x104, 0x101),
+			vm.CreateABC(vm.OP_NEWTABLE, 1, 2, 0),
+			vm.CreateABx(vm.OP_LOADK, 2, 2),
+			vm.CreateABx(vm.OP_LOADK, 3, 3),
+			vm.CreateABC(vm.OP_SETLIST, 1, 2, 1),
+			vm.CreateABx(vm.OP_CLOSURE, 2, 0),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		Constants:    []interface{}{"print", "hi", int64(1), 2.5, "x"},
+		LineInfo:     []uint32{1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 5, 5},
+		LocVars:      []binary.LocVar{{VarName: "s", StartPC: 1, EndPC: 14}, {VarName: "t", StartPC: 12, EndPC: 14}},
+		Upvalues:     []binary.Upvalue{{InStack: 1, Idx: 0}},
+		UpvalueNames: []string{"_ENV"},
+		Protos:       []*binary.Prototype{inner},
+	}
+
+	annotating = true
+	defer func() { annotating = false }()
+	got := captureStdout(t, func() { printFunction(main, true, sourceFiles{}) })
+	want := "\nmain <f.lua:0,0> (14 instructions)\n" +
+		"0+ params, 4 slots, 1 upvalue, 2 locals, 5 constants, 1 function\n" +
+		"\t1\t[1]\tLOADK    \t0 -2\t; \"hi\"\n" +
+		"\t2\t[2]\tGETTABUP \t1 0 -1\t; _ENV \"print\"; locals: s\n" +
+		"\t3\t[2]\tMOVE     \t2 0\t; locals: s\n" +
+		"\t4\t[2]\tCALL     \t1 2 1\t; locals: s\n" +
+		"\t5\t[2]\tADD      \t1 0 -3\t; - 1; locals: s\n" +
+		"\t6\t[2]\tEQ       \t1 0 -4\t; - 2.5; locals: s\n" +
+		"\t7\t[2]\tJMP      \t0 1\t; to 9; locals: s\n" +
+		"\t8\t[2]\tSETTABUP \t0 -5 -2\t; _ENV \"x\" \"hi\"; locals: s\n" +
+		"\t9\t[2]\tNEWTABLE \t1 2 0\t; locals: s\n" +
+		"\t10\t[2]\tLOADK    \t2 -3\t; 1; locals: s\n" +
+		"\t11\t[2]\tLOADK    \t3 -4\t; 2.5; locals: s\n" +
+		"\t12\t[2]\tSETLIST  \t1 2 1\t; 1; locals: s\n" +
+		"\t13\t[5]\tCLOSURE  \t2 0\t; function <f.lua:3,5>; locals: s t\n" +
+		"\t14\t[5]\tRETURN   \t0 1\t; locals: s t\n" +
+		"constants (5):\n" +
+		"\t1\t\"print\"\n" +
+		"\t2\t\"hi\"\n" +
+		"\t3\t1\n" +
+		"\t4\t2.5\n" +
+		"\t5\t\"x\"\n" +
+		"locals (2):\n" +
+		"\t0\ts\t2\t15\n" +
+		"\t1\tt\t13\t15\n" +
+		"upvalues (1):\n" +
+		"\t0\t_ENV\t1\t0\n" +
+		"\nfunction <f.lua:3,5> (6 instructions)\n" +
+		"0 params, 2 slots, 1 upvalue, 0 locals, 0 constants, 0 functions\n" +
+		"\t1\t[4]\tGETUPVAL \t0 0\t; s\n" +
+		"\t2\t[4]\tSETUPVAL \t0 0\t; s\n" +
+		"\t3\t[4]\tNEWTABLE \t0 0 0\n" +
+		"\t4\t[4]\tSETLIST  \t0 0 0\t; 51\n" +
+		"\t5\t[4]\tEXTRAARG \t-52\n" +
+		"\t6\t[5]\tRETURN   \t0 1\n" +
+		"constants (0):\n" +
+		"locals (0):\n" +
+		"upvalues (1):\n" +
+		"\t0\ts\t1\t0\n"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
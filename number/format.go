@@ -0,0 +1,35 @@
+package number
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/* format used to convert floats to strings (LUAI_NUMFFORMAT) */
+const LUAI_NUMFFORMAT = "%.14g"
+
+/* convert a float to a string as Lua does, keeping integral values recognizable as floats */
+func FloatToString(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		if math.Signbit(f) {
+			return "-nan"
+		}
+		return "nan"
+	}
+	s := fmt.Sprintf(LUAI_NUMFFORMAT, f)
+	if strings.Trim(s, "-0123456789") == "" { // looks like an int?
+		s += ".0"
+	}
+	return s
+}
+
+func IntegerToString(i int64) string {
+	return strconv.FormatInt(i, 10)
+}
@@ -0,0 +1,38 @@
+package number
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFloatToString(t *testing.T) {
+	tests := []struct {
+		f float64
+		s string
+	}{
+		{1, "1.0"},
+		{-1, "-1.0"},
+		{0, "0.0"},
+		{math.Copysign(0, -1), "-0.0"},
+		{0.1, "0.1"},
+		{1e15, "1e+15"},
+		{1e14, "1e+14"},
+		{123456789012345, "1.2345678901234e+14"},
+		{12345678901234, "12345678901234.0"},
+		{3.14159265358979, "3.1415926535898"},
+		{1e-5, "1e-05"},
+		{2.5e-300, "2.5e-300"},
+		{math.Inf(1), "inf"},
+		{math.Inf(-1), "-inf"},
+		{math.NaN(), "nan"},
+		{math.Copysign(math.NaN(), -1), "-nan"},
+	}
+	for _, test := range tests {
+		if s := FloatToString(test.f); s != test.s {
+			t.Errorf("FloatToString(%v) = %q, want %q", test.f, s, test.s)
+		}
+	}
+	if s := IntegerToString(math.MinInt64); s != "-9223372036854775808" {
+		t.Errorf("IntegerToString(math.MinInt64) = %q", s)
+	}
+}
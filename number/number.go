@@ -2,27 +2,43 @@ package number
 
 import (
 	"math"
-	"strconv"
 )
 
+/* integer floor division (luaV_div); b must not be 0, and MinInt64 // -1 wraps around */
 func IFloorDiv(a, b int64) int64 {
-	if a > 0 && b > 0 || a < 0 && b < 0 || a%b == 0 {
-		return a / b
-	} else {
-		return a/b - 1
+	if b == -1 {
+		return -a // avoid overflow with 0x80000...//-1
+	}
+	q := a / b
+	if (a^b) < 0 && a%b != 0 { // different signs and non-integral quotient?
+		q -= 1 // correct result for different rounding
 	}
+	return q
 }
 
 func FFloorDiv(a, b float64) float64 {
 	return math.Floor(a / b)
 }
 
+/* integer modulus (luaV_mod); b must not be 0 */
 func IMod(a, b int64) int64 {
-	return a - IFloorDiv(a, b)*b
+	if b == -1 {
+		return 0 // avoid overflow with 0x80000...%-1
+	}
+	r := a % b
+	if r != 0 && (r^b) < 0 { // different signs?
+		r += b // correct result for different rounding
+	}
+	return r
 }
 
+/* float modulus (luai_nummod): C fmod, shifted to the sign of b */
 func FMod(a, b float64) float64 {
-	return a - FFloorDiv(a, b)*b
+	m := math.Mod(a, b)
+	if m*b < 0 {
+		m += b
+	}
+	return m
 }
 
 func ShiftLeft(a, n int64) int64 {
@@ -41,17 +57,49 @@ func ShiftRight(a, n int64) int64 {
 	}
 }
 
-func FloatToInteger(f float64) (int64, bool) {
-	i := int64(f)
-	return i, float64(i) == f
+/*
+ * rounding modes for float->integer coercion
+ */
+const (
+	F2Ieq    = iota // no rounding; accepts only integral values
+	F2Ifloor        // takes the floor of the number
+	F2Iceil         // takes the ceil of the number
+)
+
+/* float->integer conversion in the given mode; fails for NaN and values outside [-2^63, 2^63) */
+func FloatToIntegerMode(f float64, mode int) (int64, bool) {
+	i := math.Floor(f)
+	if i != f {
+		if mode == F2Ieq {
+			return 0, false // not an integral value
+		} else if mode == F2Iceil {
+			i += 1
+		}
+	}
+	if i >= -(1<<63) && i < 1<<63 {
+		return int64(i), true
+	}
+	return 0, false
 }
 
-func ParseInteger(s string) (int64, bool) {
-	i, err := strconv.ParseInt(s, 10, 64)
-	return i, err == nil
+func FloatToInteger(f float64) (int64, bool) {
+	return FloatToIntegerMode(f, F2Ieq)
 }
 
-func ParseFloat(s string) (float64, bool) {
-	f, err := strconv.ParseFloat(s, 64)
-	return f, err == nil
+/*
+ * integer limit of a numeric for loop with a float limit f and an integer
+ * step, and whether the loop must not run at all (forlimit in lvm.c)
+ */
+func ForLimit(f float64, step int64) (int64, bool) {
+	mode := F2Ifloor
+	if step < 0 {
+		mode = F2Iceil
+	}
+	if i, ok := FloatToIntegerMode(f, mode); ok {
+		return i, false
+	}
+	if 0 < f { // larger than the maximum integer
+		return math.MaxInt64, step < 0
+	}
+	return math.MinInt64, step >= 0 // smaller than the minimum integer, or NaN
 }
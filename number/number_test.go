@@ -0,0 +1,114 @@
+package number
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFloatToIntegerMode(t *testing.T) {
+	const two63 = 9223372036854775808.0
+	below := math.Nextafter(two63, 0) // largest float below 2^63
+	tests := []struct {
+		f                float64
+		eq, floor, ceil  int64
+		eqOk, flOk, ceOk bool
+	}{
+		{0, 0, 0, 0, true, true, true},
+		{math.Copysign(0, -1), 0, 0, 0, true, true, true},
+		{3, 3, 3, 3, true, true, true},
+		{3.5, 0, 3, 4, false, true, true},
+		{-3.5, 0, -4, -3, false, true, true},
+		{0.1, 0, 0, 1, false, true, true},
+		{-0.1, 0, -1, 0, false, true, true},
+		{below, int64(below), int64(below), int64(below), true, true, true},
+		{two63, 0, 0, 0, false, false, false},
+		{-two63, math.MinInt64, math.MinInt64, math.MinInt64, true, true, true},
+		{math.Nextafter(-two63, math.Inf(-1)), 0, 0, 0, false, false, false},
+		{1e300, 0, 0, 0, false, false, false},
+		{math.Inf(1), 0, 0, 0, false, false, false},
+		{math.Inf(-1), 0, 0, 0, false, false, false},
+		{math.NaN(), 0, 0, 0, false, false, false},
+	}
+	for _, test := range tests {
+		for _, c := range []struct {
+			mode int
+			want int64
+			ok   bool
+		}{{F2Ieq, test.eq, test.eqOk}, {F2Ifloor, test.floor, test.flOk}, {F2Iceil, test.ceil, test.ceOk}} {
+			if i, ok := FloatToIntegerMode(test.f, c.mode); ok != c.ok || ok && i != c.want {
+				t.Errorf("FloatToIntegerMode(%v, %d) = %d, %t; want %d, %t", test.f, c.mode, i, ok, c.want, c.ok)
+			}
+		}
+	}
+}
+
+func TestForLimit(t *testing.T) {
+	tests := []struct {
+		f     float64
+		step  int64
+		limit int64
+		skip  bool
+	}{
+		{10.5, 1, 10, false},
+		{10.5, -1, 11, false},
+		{1e100, 1, math.MaxInt64, false},
+		{1e100, -1, math.MaxInt64, true},
+		{-1e100, 1, math.MinInt64, true},
+		{-1e100, -1, math.MinInt64, false},
+		{math.NaN(), 1, math.MinInt64, true},
+	}
+	for _, test := range tests {
+		if limit, skip := ForLimit(test.f, test.step); limit != test.limit || skip != test.skip {
+			t.Errorf("ForLimit(%v, %d) = %d, %t; want %d, %t", test.f, test.step, limit, skip, test.limit, test.skip)
+		}
+	}
+}
+
+func TestDivMod(t *testing.T) {
+	tests := []struct{ a, b, q, r int64 }{
+		{7, 2, 3, 1},
+		{-7, 2, -4, 1},
+		{7, -2, -4, -1},
+		{-7, -2, 3, -1},
+		{6, -3, -2, 0},
+		{0, -5, 0, 0},
+		{math.MinInt64, -1, math.MinInt64, 0},
+		{math.MaxInt64, -1, -math.MaxInt64, 0},
+		{math.MinInt64, 1, math.MinInt64, 0},
+		{math.MinInt64, math.MaxInt64, -2, math.MaxInt64 - 1},
+	}
+	for _, test := range tests {
+		if q := IFloorDiv(test.a, test.b); q != test.q {
+			t.Errorf("IFloorDiv(%d, %d) = %d, want %d", test.a, test.b, q, test.q)
+		}
+		if r := IMod(test.a, test.b); r != test.r {
+			t.Errorf("IMod(%d, %d) = %d, want %d", test.a, test.b, r, test.r)
+		}
+	}
+}
+
+func TestFMod(t *testing.T) {
+	inf := math.Inf(1)
+	tests := []struct{ a, b, r float64 }{
+		{5.5, 2, 1.5},
+		{-5.5, 2, 0.5},
+		{5.5, -2, -0.5},
+		{-5.5, -2, -1.5},
+		{5.5, inf, 5.5},
+		{-5.5, inf, inf},
+		{5.5, -inf, -inf},
+		{-5.5, -inf, -5.5},
+		{math.Copysign(0, -1), 2, math.Copysign(0, -1)},
+		{4, -2, 0},
+	}
+	for _, test := range tests {
+		if r := FMod(test.a, test.b); r != test.r || math.Signbit(r) != math.Signbit(test.r) {
+			t.Errorf("FMod(%g, %g) = %g, want %g", test.a, test.b, r, test.r)
+		}
+	}
+	for _, c := range [][2]float64{{inf, 2}, {1, 0}, {math.NaN(), 1}} {
+		if r := FMod(c[0], c[1]); !math.IsNaN(r) {
+			t.Errorf("FMod(%g, %g) = %g, want nan", c[0], c[1], r)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package number
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+/* white space as recognized by Lua (isspace in the C locale) */
+const spaces = " \t\n\v\f\r"
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func hexValue(c byte) (int, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0'), true
+	case 'a' <= c && c <= 'f':
+		return int(c-'a') + 10, true
+	case 'A' <= c && c <= 'F':
+		return int(c-'A') + 10, true
+	}
+	return 0, false
+}
+
+/* s without a leading '-' or '+', and whether it was '-' */
+func sign(s string) (string, bool) {
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		return s[1:], s[0] == '-'
+	}
+	return s, false
+}
+
+func hasHexPrefix(s string) bool {
+	return len(s) >= 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X')
+}
+
+/*
+ * convert an integer numeral as Lua does (l_str2int): surrounding white
+ * space is ignored, hexadecimal numerals wrap around, and decimal ones
+ * that do not fit in an int64 are not integers.
+ */
+func ParseInteger(s string) (int64, bool) {
+	s, neg := sign(strings.Trim(s, spaces))
+	var a uint64
+	if hasHexPrefix(s) {
+		s = s[2:]
+		if s == "" {
+			return 0, false
+		}
+		for i := 0; i < len(s); i++ {
+			d, ok := hexValue(s[i])
+			if !ok {
+				return 0, false
+			}
+			a = a*16 + uint64(d)
+		}
+	} else {
+		if s == "" {
+			return 0, false
+		}
+		limit := uint64(math.MaxInt64)
+		if neg {
+			limit++
+		}
+		for i := 0; i < len(s); i++ {
+			if !isDigit(s[i]) {
+				return 0, false
+			}
+			d := uint64(s[i] - '0')
+			if a > (limit-d)/10 { // overflow
+				return 0, false
+			}
+			a = a*10 + d
+		}
+	}
+	if neg {
+		a = -a
+	}
+	return int64(a), true
+}
+
+/*
+ * convert a numeral to a float as Lua does (l_str2d): surrounding white
+ * space is ignored, hexadecimal numerals may have a fraction and a binary
+ * exponent, and 'inf' or 'nan' are not numerals.
+ */
+func ParseFloat(s string) (float64, bool) {
+	s = strings.Trim(s, spaces)
+	if digits, neg := sign(s); hasHexPrefix(digits) {
+		f, ok := parseHexFloat(digits[2:])
+		if neg {
+			f = -f
+		}
+		return f, ok
+	}
+	if !isDecimalFloat(s) {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil && err.(*strconv.NumError).Err != strconv.ErrRange { // overflow gives ±HUGE_VAL as in C
+		return 0, false
+	}
+	return f, true
+}
+
+/* whether s is [+-]digits[.digits][(e|E)[+-]digits], with at least one digit before the exponent */
+func isDecimalFloat(s string) bool {
+	s, _ = sign(s)
+	i, n := 0, 0
+	for ; i < len(s) && isDigit(s[i]); i++ {
+		n++
+	}
+	if i < len(s) && s[i] == '.' {
+		for i++; i < len(s) && isDigit(s[i]); i++ {
+			n++
+		}
+	}
+	if n == 0 {
+		return false
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		exp, _ := sign(s[i+1:])
+		if exp == "" {
+			return false
+		}
+		for j := 0; j < len(exp); j++ {
+			if !isDigit(exp[j]) {
+				return false
+			}
+		}
+		return true
+	}
+	return i == len(s)
+}
+
+/* hexdigits[.hexdigits][(p|P)[+-]digits], following lua_strx2number */
+func parseHexFloat(s string) (float64, bool) {
+	const maxSigDig = 30
+	r := 0.0
+	e := 0      // exponent correction
+	sigdig := 0 // number of significant digits
+	hasdot, digits := false, false
+	i := 0
+	for ; i < len(s); i++ {
+		if s[i] == '.' {
+			if hasdot {
+				break
+			}
+			hasdot = true
+			continue
+		}
+		d, ok := hexValue(s[i])
+		if !ok {
+			break
+		}
+		digits = true
+		if sigdig > 0 || d != 0 { // leading zeros are not significant
+			if sigdig++; sigdig <= maxSigDig {
+				r = r*16 + float64(d)
+			} else {
+				e++ // too many digits; ignore, but still count for the exponent
+			}
+		}
+		if hasdot {
+			e-- // decimal digit? correct the exponent
+		}
+	}
+	if !digits {
+		return 0, false
+	}
+	e *= 4 // each digit multiplies/divides the value by 2^4
+	if i < len(s) && (s[i] == 'p' || s[i] == 'P') {
+		exp, neg := sign(s[i+1:])
+		if exp == "" {
+			return 0, false
+		}
+		exp1 := 0
+		for j := 0; j < len(exp); j++ {
+			if !isDigit(exp[j]) {
+				return 0, false
+			}
+			if exp1 < 1<<20 { // large enough to over- or underflow anyway
+				exp1 = exp1*10 + int(exp[j]-'0')
+			}
+		}
+		if neg {
+			exp1 = -exp1
+		}
+		e += exp1
+	} else if i < len(s) {
+		return 0, false
+	}
+	return math.Ldexp(r, e), true
+}
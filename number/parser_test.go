@@ -0,0 +1,79 @@
+package number
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseInteger(t *testing.T) {
+	tests := []struct {
+		s  string
+		i  int64
+		ok bool
+	}{
+		{"42", 42, true},
+		{" 42 ", 42, true},
+		{"\t-7\n", -7, true},
+		{"+7", 7, true},
+		{"0x10", 16, true},
+		{"0XfF", 255, true},
+		{"0xffffffffffffffff", -1, true}, // wraps around
+		{"0x10000000000000000", 0, true},
+		{"-0x1", -1, true},
+		{"9223372036854775807", math.MaxInt64, true},
+		{"-9223372036854775808", math.MinInt64, true},
+		{"9223372036854775808", 0, false}, // a float
+		{"1e2", 0, false},
+		{"10.", 0, false},
+		{"", 0, false},
+		{" ", 0, false},
+		{"0x", 0, false},
+		{"-", 0, false},
+		{"1_000", 0, false},
+		{"0b101", 0, false},
+		{"1 2", 0, false},
+		{"--1", 0, false},
+	}
+	for _, test := range tests {
+		if i, ok := ParseInteger(test.s); ok != test.ok || ok && i != test.i {
+			t.Errorf("ParseInteger(%q) = %d, %t; want %d, %t", test.s, i, ok, test.i, test.ok)
+		}
+	}
+}
+
+func TestParseFloat(t *testing.T) {
+	tests := []struct {
+		s  string
+		f  float64
+		ok bool
+	}{
+		{"1e2 ", 100, true},
+		{"10.", 10, true},
+		{".5", 0.5, true},
+		{"-.5e-1", -0.05, true},
+		{"0x10", 16, true},
+		{"0x1p4", 16, true},
+		{"  0x.8  ", 0.5, true},
+		{"0xA.8p1", 21, true},
+		{"-0x1P-2", -0.25, true},
+		{"0x1p", 0, false},
+		{"0x.", 0, false},
+		{"1e400", math.Inf(1), true},
+		{"9223372036854775808", 9223372036854775808, true},
+		{"1e", 0, false},
+		{"e1", 0, false},
+		{".", 0, false},
+		{"Inf", 0, false},
+		{"-inf", 0, false},
+		{"NaN", 0, false},
+		{"1_000", 0, false},
+		{"0b101", 0, false},
+		{"1.5f", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		if f, ok := ParseFloat(test.s); ok != test.ok || ok && f != test.f {
+			t.Errorf("ParseFloat(%q) = %g, %t; want %g, %t", test.s, f, ok, test.f, test.ok)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package optimize
+
+import (
+	"fmt"
+
+	"github.com/uganh16/luago/binary"
+	"github.com/uganh16/luago/vm"
+)
+
+/*
+ * make sure every register operand of p and its nested functions, including
+ * the ranges CALL, RETURN, SETLIST and the loops use, is below MaxStackSize,
+ * every constant, upvalue and function index is in range and every jump
+ * lands inside the code.
+ */
+func Check(p *binary.Prototype) error {
+	return check(p, "main")
+}
+
+func check(p *binary.Prototype, path string) error {
+	for pc, i := range p.Code {
+		if err := checkInstruction(p, pc, i); err != nil {
+			return fmt.Errorf("%s: [%d] %s: %v", path, pc+1, i.OpName(), err)
+		}
+	}
+	for idx, proto := range p.Protos {
+		if err := check(proto, fmt.Sprintf("%s/%d", path, idx)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkInstruction(p *binary.Prototype, pc int, i vm.Instruction) error {
+	register := func(r int) error {
+		if r >= int(p.MaxStackSize) {
+			return fmt.Errorf("register %d out of range", r)
+		}
+		return nil
+	}
+	constant := func(k int) error {
+		if k >= len(p.Constants) {
+			return fmt.Errorf("constant %d out of range", k)
+		}
+		return nil
+	}
+	upvalue := func(u int) error {
+		if u >= len(p.Upvalues) {
+			return fmt.Errorf("upvalue %d out of range", u)
+		}
+		return nil
+	}
+	operand := func(mode byte, x int) error {
+		switch {
+		case mode == vm.OpArgR:
+			return register(x)
+		case mode == vm.OpArgK && x > 0xff:
+			return constant(x & 0xff)
+		case mode == vm.OpArgK:
+			return register(x)
+		}
+		return nil
+	}
+	extraArg := func() (int, error) {
+		if pc+1 >= len(p.Code) || p.Code[pc+1].Opcode() != vm.OP_EXTRAARG {
+			return 0, fmt.Errorf("not followed by EXTRAARG")
+		}
+		return p.Code[pc+1].Ax(), nil
+	}
+
+	if i.Opcode() > vm.OP_EXTRAARG {
+		return fmt.Errorf("unknown opcode %d", i.Opcode())
+	}
+	a, b, c := i.ABC()
+	_, bx := i.ABx()
+	_, sbx := i.AsBx()
+	var errs []error
+	switch i.OpMode() {
+	case vm.IABC:
+		errs = append(errs, operand(i.BMode(), b), operand(i.CMode(), c))
+	case vm.IAsBx:
+		if target := pc + 1 + sbx; target < 0 || target >= len(p.Code) {
+			errs = append(errs, fmt.Errorf("jump to %d out of range", target+1))
+		}
+	}
+
+	switch i.Opcode() {
+	case vm.OP_LOADK:
+		errs = append(errs, register(a), constant(bx))
+	case vm.OP_LOADKX:
+		ax, err := extraArg()
+		if err == nil {
+			err = constant(ax)
+		}
+		errs = append(errs, register(a), err)
+	case vm.OP_LOADNIL:
+		errs = append(errs, register(a+b))
+	case vm.OP_GETUPVAL, vm.OP_SETUPVAL, vm.OP_GETTABUP:
+		errs = append(errs, register(a), upvalue(b))
+	case vm.OP_SETTABUP:
+		errs = append(errs, upvalue(a))
+	case vm.OP_SELF:
+		errs = append(errs, register(a+1))
+	case vm.OP_JMP:
+		if a > 0 { // closes upvalues from R(A-1) up
+			errs = append(errs, register(a-1))
+		}
+	case vm.OP_EQ, vm.OP_LT, vm.OP_LE, vm.OP_EXTRAARG:
+		// A is not a register
+	case vm.OP_CALL:
+		errs = append(errs, register(a))
+		if b > 0 {
+			errs = append(errs, register(a+b-1))
+		}
+		if c > 1 {
+			errs = append(errs, register(a+c-2))
+		}
+	case vm.OP_TAILCALL:
+		errs = append(errs, register(a))
+		if b > 0 {
+			errs = append(errs, register(a+b-1))
+		}
+	case vm.OP_RETURN:
+		if b == 0 {
+			errs = append(errs, register(a))
+		} else if b > 1 {
+			errs = append(errs, register(a+b-2))
+		}
+	case vm.OP_VARARG:
+		errs = append(errs, register(a))
+		if b > 1 {
+			errs = append(errs, register(a+b-2))
+		}
+	case vm.OP_FORLOOP, vm.OP_FORPREP:
+		errs = append(errs, register(a+3))
+	case vm.OP_TFORCALL:
+		errs = append(errs, register(a+2+c))
+	case vm.OP_TFORLOOP:
+		errs = append(errs, register(a+1))
+	case vm.OP_SETLIST:
+		errs = append(errs, register(a+b))
+		if c == 0 {
+			_, err := extraArg()
+			errs = append(errs, err)
+		}
+	case vm.OP_CLOSURE:
+		errs = append(errs, register(a))
+		if bx >= len(p.Protos) {
+			errs = append(errs, fmt.Errorf("function %d out of range", bx))
+			break
+		}
+		for _, u := range p.Protos[bx].Upvalues {
+			if u.InStack != 0 {
+				errs = append(errs, register(int(u.Idx)))
+			} else {
+				errs = append(errs, upvalue(int(u.Idx)))
+			}
+		}
+	default:
+		errs = append(errs, register(a))
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package optimize
+
+import (
+	"math"
+
+	"github.com/uganh16/luago/binary"
+	"github.com/uganh16/luago/vm"
+)
+
+/*
+ * drop repeated constants from p and its nested functions, pointing LOADK,
+ * LOADKX and RK operands at the first copy. Return the number of
+ * constants dropped and the bytes this saves in the dumped chunk.
+ */
+func Dedup(p *binary.Prototype) (int, int) {
+	removed, saved := 0, 0
+	for _, proto := range p.Protos {
+		r, s := Dedup(proto)
+		removed += r
+		saved += s
+	}
+
+	type key struct {
+		k    interface{}
+		bits uint64 // floats are told apart by their bits, so -0 stays apart from 0
+	}
+	index := map[key]int{}
+	remap := make([]int, len(p.Constants))
+	var constants []interface{}
+	for idx, k := range p.Constants {
+		kk := key{k: k}
+		if f, ok := k.(float64); ok {
+			kk = key{k: 0.0, bits: math.Float64bits(f)}
+		}
+		if first, ok := index[kk]; ok {
+			remap[idx] = first
+			removed++
+			saved += constantSize(k)
+			continue
+		}
+		index[kk] = len(constants)
+		remap[idx] = len(constants)
+		constants = append(constants, k)
+	}
+	if len(constants) == len(p.Constants) {
+		return removed, saved
+	}
+
+	rk := func(mode byte, x int) int {
+		if mode == vm.OpArgK && x > 0xff {
+			return 0x100 | remap[x&0xff]
+		}
+		return x
+	}
+	for pc, i := range p.Code {
+		switch {
+		case i.Opcode() == vm.OP_LOADK:
+			a, bx := i.ABx()
+			p.Code[pc] = vm.CreateABx(vm.OP_LOADK, a, remap[bx])
+		case i.Opcode() == vm.OP_LOADKX && pc+1 < len(p.Code):
+			p.Code[pc+1] = vm.CreateAx(vm.OP_EXTRAARG, remap[p.Code[pc+1].Ax()])
+		case i.OpMode() == vm.IABC:
+			a, b, c := i.ABC()
+			p.Code[pc] = vm.CreateABC(i.Opcode(), a, rk(i.BMode(), b), rk(i.CMode(), c))
+		}
+	}
+	p.Constants = constants
+	return removed, saved
+}
+
+/* bytes taken by constant k in a dumped chunk */
+func constantSize(k interface{}) int {
+	switch k := k.(type) {
+	case bool:
+		return 1 + 1
+	case int64, float64:
+		return 1 + 8
+	case string:
+		if len(k)+1 < 0xff {
+			return 1 + 1 + len(k)
+		}
+		return 1 + 1 + 8 + len(k)
+	}
+	return 1 // nil
+}
@@ -0,0 +1,62 @@
+package optimize
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/uganh16/luago/binary"
+	"github.com/uganh16/luago/vm"
+)
+
+func TestDedup(t *testing.T) {
+	inner := &binary.Prototype{
+		MaxStackSize: 1,
+		Code: []vm.Instruction{
+			vm.CreateABx(vm.OP_LOADK, 0, 1),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		Constants: []interface{}{int64(7), int64(7)},
+	}
+	p := &binary.Prototype{
+		MaxStackSize: 2,
+		Code: []vm.Instruction{
+			vm.CreateABC(vm.OP_GETTABUP, 0, 0, 0x102),     // _ENV["print"]
+			vm.CreateABx(vm.OP_LOADK, 1, 3),               // "print"
+			vm.CreateABC(vm.OP_SETTABUP, 0, 0x104, 0x105), // _ENV[-0.0] = 0.0
+			vm.CreateABC(vm.OP_EQ, 0, 0x103, 1),           // "print" == R1
+			vm.CreateAsBx(vm.OP_JMP, 0, 0),
+			vm.CreateABx(vm.OP_LOADKX, 1, 0),
+			vm.CreateAx(vm.OP_EXTRAARG, 6), // 1.0
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		Constants: []interface{}{1.0, int64(1), "print", "print", math.Copysign(0, -1), 0.0, 1.0},
+		Protos:    []*binary.Prototype{inner},
+	}
+	removed, saved := Dedup(p)
+
+	want := strings.Join([]string{
+		"GETTABUP 0 0 -3",
+		"LOADK 1 -3",
+		"SETTABUP 0 -4 -5",
+		"EQ 0 -3 1",
+		"JMP 0 0",
+		"LOADKX 1",
+		"EXTRAARG -1",
+		"RETURN 0 1",
+	}, "\n")
+	if got := listing(p); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if len(p.Constants) != 5 || p.Constants[2] != "print" || !math.Signbit(p.Constants[3].(float64)) {
+		t.Errorf("unexpected constants %v", p.Constants)
+	}
+	if !reflect.DeepEqual(inner.Constants, []interface{}{int64(7)}) || listing(inner) != "LOADK 0 -1\nRETURN 0 1" {
+		t.Errorf("nested function not deduplicated: %v", inner.Constants)
+	}
+	// "print" takes 1+1+5 bytes, the float 1.0 and the nested function's integer 7 take 1+8 each
+	if removed != 3 || saved != 7+9+9 {
+		t.Errorf("got %d constants removed and %d bytes saved", removed, saved)
+	}
+}
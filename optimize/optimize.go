@@ -0,0 +1,350 @@
+package optimize
+
+import (
+	"math"
+
+	"github.com/uganh16/luago/binary"
+	"github.com/uganh16/luago/cfg"
+	"github.com/uganh16/luago/number"
+	"github.com/uganh16/luago/vm"
+)
+
+/* number of rewrites of each kind made by Optimize */
+type Stats struct {
+	Threaded int // jumps retargeted past other jumps
+	Folded   int // arithmetic instructions turned into LOADK
+	Moves    int // redundant MOVE instructions removed
+	Nils     int // LOADNIL instructions merged into the previous one
+	Dead     int // unreachable instructions removed
+}
+
+func (s *Stats) add(t Stats) {
+	s.Threaded += t.Threaded
+	s.Folded += t.Folded
+	s.Moves += t.Moves
+	s.Nils += t.Nils
+	s.Dead += t.Dead
+}
+
+/*
+ * rewrite p and its nested functions in place with peephole
+ * optimizations, keeping LineInfo and LocVars in step with the code. p
+ * is checked before and after; it is left untouched if it is malformed.
+ */
+func Optimize(p *binary.Prototype) (Stats, error) {
+	if err := Check(p); err != nil {
+		return Stats{}, err
+	}
+	stats := optimize(p)
+	return stats, Check(p)
+}
+
+func optimize(p *binary.Prototype) Stats {
+	var stats Stats
+	for _, proto := range p.Protos {
+		stats.add(optimize(proto))
+	}
+	o := newOptimizer(p)
+	o.threadJumps(&stats)
+	o.foldConstants(&stats)
+	o.removeMoves(&stats)
+	o.mergeNils(&stats)
+	o.rebuild()
+	o = newOptimizer(p)
+	o.removeDeadCode(&stats)
+	o.rebuild()
+	return stats
+}
+
+type optimizer struct {
+	p       *binary.Prototype
+	targets []int  // jump target of each instruction, or -1
+	removed []bool // instructions to drop
+	jumpIn  []bool // instructions some jump lands on
+}
+
+func newOptimizer(p *binary.Prototype) *optimizer {
+	o := &optimizer{
+		p:       p,
+		targets: make([]int, len(p.Code)),
+		removed: make([]bool, len(p.Code)),
+		jumpIn:  make([]bool, len(p.Code)+1),
+	}
+	for pc, i := range p.Code {
+		o.targets[pc] = -1
+		if isJump(i) {
+			_, sbx := i.AsBx()
+			o.targets[pc] = pc + 1 + sbx
+			o.jumpIn[pc+1+sbx] = true
+		} else if skips(i) {
+			o.jumpIn[pc+2] = true
+		}
+	}
+	return o
+}
+
+/* instructions with a sBx jump offset */
+func isJump(i vm.Instruction) bool {
+	switch i.Opcode() {
+	case vm.OP_JMP, vm.OP_FORPREP, vm.OP_FORLOOP, vm.OP_TFORLOOP:
+		return true
+	}
+	return false
+}
+
+/* instructions that may skip the next one */
+func skips(i vm.Instruction) bool {
+	if i.Opcode() == vm.OP_LOADBOOL {
+		_, _, c := i.ABC()
+		return c != 0
+	}
+	return i.TestFlag()
+}
+
+/* whether the instruction at pc may be removed or rewritten without changing what runs before it */
+func (o *optimizer) replaceable(pc int) bool {
+	return !o.jumpIn[pc] && (pc == 0 || !skips(o.p.Code[pc-1]))
+}
+
+/* retarget jumps that land on an unconditional JMP that closes nothing */
+func (o *optimizer) threadJumps(stats *Stats) {
+	for pc, i := range o.p.Code {
+		if i.Opcode() != vm.OP_JMP {
+			continue
+		}
+		seen := map[int]bool{pc: true}
+		t := o.targets[pc]
+		for t < len(o.p.Code) && !seen[t] && o.p.Code[t].Opcode() == vm.OP_JMP {
+			if a, _ := o.p.Code[t].AsBx(); a != 0 {
+				break
+			}
+			seen[t] = true
+			t = o.targets[t]
+		}
+		if t != o.targets[pc] && !seen[t] {
+			o.targets[pc] = t
+			stats.Threaded++
+		}
+	}
+}
+
+/* replace arithmetic over two constants by a LOADK of the result */
+func (o *optimizer) foldConstants(stats *Stats) {
+	for pc, i := range o.p.Code {
+		if i.Opcode() < vm.OP_ADD || i.Opcode() > vm.OP_SHR {
+			continue
+		}
+		a, b, c := i.ABC()
+		if b <= 0xff || c <= 0xff {
+			continue
+		}
+		k, ok := fold(i.Opcode(), o.p.Constants[b&0xff], o.p.Constants[c&0xff])
+		if !ok {
+			continue
+		}
+		if idx, ok := o.constant(k); ok {
+			o.p.Code[pc] = vm.CreateABx(vm.OP_LOADK, a, idx)
+			stats.Folded++
+		}
+	}
+}
+
+/* index of constant k, added to the pool if missing and LOADK can still reach it */
+func (o *optimizer) constant(k interface{}) (int, bool) {
+	for idx, x := range o.p.Constants {
+		if f, ok := x.(float64); ok && f == 0 && math.Signbit(f) {
+			continue // -0 equals 0 but is not the same constant
+		}
+		if x == k { // same type and value
+			return idx, true
+		}
+	}
+	if len(o.p.Constants) > vm.MAXARG_Bx {
+		return 0, false
+	}
+	o.p.Constants = append(o.p.Constants, k)
+	return len(o.p.Constants) - 1, true
+}
+
+/* result of an arithmetic opcode over constants a and b, unless it may raise an error or is NaN or -0 */
+func fold(op int, a, b interface{}) (interface{}, bool) {
+	x, xInt := a.(int64)
+	y, yInt := b.(int64)
+	if xInt && yInt {
+		switch op {
+		case vm.OP_ADD:
+			return x + y, true
+		case vm.OP_SUB:
+			return x - y, true
+		case vm.OP_MUL:
+			return x * y, true
+		case vm.OP_MOD:
+			if y != 0 {
+				return number.IMod(x, y), true
+			}
+			return nil, false
+		case vm.OP_IDIV:
+			if y != 0 {
+				return number.IFloorDiv(x, y), true
+			}
+			return nil, false
+		case vm.OP_BAND:
+			return x & y, true
+		case vm.OP_BOR:
+			return x | y, true
+		case vm.OP_BXOR:
+			return x ^ y, true
+		case vm.OP_SHL:
+			return number.ShiftLeft(x, y), true
+		case vm.OP_SHR:
+			return number.ShiftRight(x, y), true
+		}
+	}
+
+	f, ok1 := toFloat(a)
+	g, ok2 := toFloat(b)
+	if !ok1 || !ok2 {
+		return nil, false
+	}
+	var r float64
+	switch op {
+	case vm.OP_ADD:
+		r = f + g
+	case vm.OP_SUB:
+		r = f - g
+	case vm.OP_MUL:
+		r = f * g
+	case vm.OP_DIV:
+		r = f / g
+	case vm.OP_POW:
+		r = math.Pow(f, g)
+	case vm.OP_MOD:
+		r = number.FMod(f, g)
+	case vm.OP_IDIV:
+		r = number.FFloorDiv(f, g)
+	default: // bitwise operations on floats are left to run time
+		return nil, false
+	}
+	if math.IsNaN(r) || r == 0 && math.Signbit(r) {
+		return nil, false
+	}
+	return r, true
+}
+
+func toFloat(k interface{}) (float64, bool) {
+	switch k := k.(type) {
+	case int64:
+		return float64(k), true
+	case float64:
+		return k, true
+	}
+	return 0, false
+}
+
+/* drop MOVE R R and the MOVE B A right after a MOVE A B */
+func (o *optimizer) removeMoves(stats *Stats) {
+	for pc, i := range o.p.Code {
+		if i.Opcode() != vm.OP_MOVE || !o.replaceable(pc) {
+			continue
+		}
+		a, b, _ := i.ABC()
+		redundant := a == b
+		if pc > 0 && !o.removed[pc-1] && o.p.Code[pc-1].Opcode() == vm.OP_MOVE {
+			pa, pb, _ := o.p.Code[pc-1].ABC()
+			redundant = redundant || pa == b && pb == a
+		}
+		if redundant {
+			o.removed[pc] = true
+			stats.Moves++
+		}
+	}
+}
+
+/* merge a LOADNIL into the previous one when their ranges touch */
+func (o *optimizer) mergeNils(stats *Stats) {
+	prev := -1
+	for pc, i := range o.p.Code {
+		if o.removed[pc] {
+			continue
+		}
+		if i.Opcode() != vm.OP_LOADNIL {
+			prev = -1
+			continue
+		}
+		if prev >= 0 && o.replaceable(pc) {
+			pa, pb, _ := o.p.Code[prev].ABC()
+			a, b, _ := i.ABC()
+			if a <= pa+pb+1 && pa <= a+b+1 { // ranges [pa, pa+pb] and [a, a+b] overlap or touch
+				from, to := pa, pa+pb
+				if a < from {
+					from = a
+				}
+				if a+b > to {
+					to = a + b
+				}
+				o.p.Code[prev] = vm.CreateABC(vm.OP_LOADNIL, from, to-from, 0)
+				o.removed[pc] = true
+				stats.Nils++
+				continue
+			}
+		}
+		prev = pc
+	}
+}
+
+/* drop the instructions control never reaches */
+func (o *optimizer) removeDeadCode(stats *Stats) {
+	g := cfg.Build(o.p)
+	for pc := range o.p.Code {
+		if !g.BlockAt(pc).Reachable() {
+			o.removed[pc] = true
+			stats.Dead++
+		}
+	}
+}
+
+/* drop the removed instructions, fixing jump offsets, line info and local scopes */
+func (o *optimizer) rebuild() {
+	p := o.p
+	// newPC[pc] is where pc, or the first instruction kept after it, ends up
+	newPC := make([]int, len(p.Code)+1)
+	n := 0
+	for pc := range p.Code {
+		newPC[pc] = n
+		if !o.removed[pc] {
+			n++
+		}
+	}
+	newPC[len(p.Code)] = n
+	at := func(pc int) int {
+		if pc > len(p.Code) {
+			return n
+		}
+		return newPC[pc]
+	}
+
+	var code []vm.Instruction
+	var lines []uint32
+	for pc, i := range p.Code {
+		if o.removed[pc] {
+			continue
+		}
+		if o.targets[pc] >= 0 {
+			a, _ := i.AsBx()
+			i = vm.CreateAsBx(i.Opcode(), a, at(o.targets[pc])-newPC[pc]-1)
+		}
+		code = append(code, i)
+		if pc < len(p.LineInfo) {
+			lines = append(lines, p.LineInfo[pc])
+		}
+	}
+	for idx := range p.LocVars {
+		locVar := &p.LocVars[idx]
+		locVar.StartPC = uint32(at(int(locVar.StartPC)))
+		locVar.EndPC = uint32(at(int(locVar.EndPC)))
+	}
+	p.Code = code
+	if p.LineInfo != nil {
+		p.LineInfo = lines
+	}
+}
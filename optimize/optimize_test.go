@@ -0,0 +1,329 @@
+package optimize
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/uganh16/luago/binary"
+	"github.com/uganh16/luago/vm"
+)
+
+func listing(p *binary.Prototype) string {
+	var lines []string
+	for _, i := range p.Code {
+		lines = append(lines, i.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func optimized(t *testing.T, p *binary.Prototype) Stats {
+	t.Helper()
+	stats, err := Optimize(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stats
+}
+
+/*
+ * local x = 1
+ * while x < 10 do
+ *   if x == 5 then break end
+ *   x = x + 1
+ * end
+ */
+func TestJumpThreading(t *testing.T) {
+	p := &binary.Prototype{
+		MaxStackSize: 1,
+		Code: []vm.Instruction{
+			vm.CreateABx(vm.OP_LOADK, 0, 0),      // 1
+			vm.CreateABC(vm.OP_LT, 0, 0, 0x101),  // 2
+			vm.CreateAsBx(vm.OP_JMP, 0, 5),       // 3 -> 9
+			vm.CreateABC(vm.OP_EQ, 0, 0, 0x102),  // 4
+			vm.CreateAsBx(vm.OP_JMP, 0, 1),       // 5 -> 7
+			vm.CreateAsBx(vm.OP_JMP, 0, 2),       // 6 -> 9
+			vm.CreateABC(vm.OP_ADD, 0, 0, 0x100), // 7
+			vm.CreateAsBx(vm.OP_JMP, 0, -8),      // 8 -> 1
+			vm.CreateAsBx(vm.OP_JMP, 0, 0),       // 9 -> 10
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),  // 10
+		},
+		Constants: []interface{}{int64(1), int64(10), int64(5)},
+		LineInfo:  []uint32{1, 2, 2, 3, 3, 3, 4, 4, 4, 5},
+	}
+	stats := optimized(t, p)
+
+	want := strings.Join([]string{
+		"LOADK 0 -1",
+		"LT 0 0 -2",
+		"JMP 0 5",
+		"EQ 0 0 -3",
+		"JMP 0 1",
+		"JMP 0 2",
+		"ADD 0 0 -1",
+		"JMP 0 -8",
+		"RETURN 0 1",
+	}, "\n")
+	if got := listing(p); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if !reflect.DeepEqual(p.LineInfo, []uint32{1, 2, 2, 3, 3, 3, 4, 4, 5}) {
+		t.Errorf("unexpected line info %v", p.LineInfo)
+	}
+	if stats.Threaded != 2 || stats.Dead != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestDeadCode(t *testing.T) {
+	p := &binary.Prototype{
+		MaxStackSize: 2,
+		Code: []vm.Instruction{
+			vm.CreateAsBx(vm.OP_JMP, 0, 2),      // 1 -> 4
+			vm.CreateABx(vm.OP_LOADK, 0, 0),     // 2
+			vm.CreateABC(vm.OP_RETURN, 0, 2, 0), // 3
+			vm.CreateABx(vm.OP_LOADK, 1, 0),     // 4
+			vm.CreateABC(vm.OP_RETURN, 1, 2, 0), // 5
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0), // 6
+		},
+		Constants: []interface{}{"x"},
+		LocVars:   []binary.LocVar{{VarName: "a", StartPC: 2, EndPC: 3}, {VarName: "b", StartPC: 4, EndPC: 6}},
+	}
+	stats := optimized(t, p)
+
+	want := "JMP 0 0\nLOADK 1 -1\nRETURN 1 2"
+	if got := listing(p); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if stats.Dead != 3 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	wantVars := []binary.LocVar{{VarName: "a", StartPC: 1, EndPC: 1}, {VarName: "b", StartPC: 2, EndPC: 3}}
+	if !reflect.DeepEqual(p.LocVars, wantVars) {
+		t.Errorf("got locals %v, want %v", p.LocVars, wantVars)
+	}
+}
+
+func TestConstantFolding(t *testing.T) {
+	p := &binary.Prototype{
+		MaxStackSize: 1,
+		Code: []vm.Instruction{
+			vm.CreateABC(vm.OP_ADD, 0, 0x100, 0x101),  // 2 + 3
+			vm.CreateABC(vm.OP_MUL, 0, 0x100, 0x102),  // 2 * 2.5
+			vm.CreateABC(vm.OP_IDIV, 0, 0x100, 0x103), // 2 // 0
+			vm.CreateABC(vm.OP_DIV, 0, 0x103, 0x103),  // 0 / 0
+			vm.CreateABC(vm.OP_MUL, 0, 0x103, 0x104),  // 0 * -1.0
+			vm.CreateABC(vm.OP_BAND, 0, 0x100, 0x102), // 2 & 2.5
+			vm.CreateABC(vm.OP_SUB, 0, 0x101, 0x100),  // 3 - 2
+			vm.CreateABC(vm.OP_ADD, 0, 0, 0x100),      // x + 2
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		Constants: []interface{}{int64(2), int64(3), 2.5, int64(0), -1.0},
+	}
+	stats := optimized(t, p)
+
+	want := strings.Join([]string{
+		"LOADK 0 -6",
+		"LOADK 0 -7",
+		"IDIV 0 -1 -4",
+		"DIV 0 -4 -4",
+		"MUL 0 -4 -5",
+		"BAND 0 -1 -3",
+		"LOADK 0 -8",
+		"ADD 0 0 -1",
+		"RETURN 0 1",
+	}, "\n")
+	if got := listing(p); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if !reflect.DeepEqual(p.Constants[5:], []interface{}{int64(5), 5.0, int64(1)}) {
+		t.Errorf("unexpected constants %v", p.Constants)
+	}
+	if stats.Folded != 3 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestFold(t *testing.T) {
+	for _, test := range []struct {
+		op   int
+		a, b interface{}
+		want interface{}
+	}{
+		{vm.OP_MOD, int64(-5), int64(3), int64(1)},
+		{vm.OP_MOD, 5.5, int64(2), 1.5},
+		{vm.OP_IDIV, int64(7), int64(-2), int64(-4)},
+		{vm.OP_POW, int64(2), int64(10), 1024.0},
+		{vm.OP_DIV, int64(1), int64(0), math.Inf(1)},
+		{vm.OP_SHL, int64(1), int64(64), int64(0)},
+		{vm.OP_BXOR, int64(5), int64(3), int64(6)},
+		{vm.OP_MOD, int64(1), int64(0), nil},
+		{vm.OP_MOD, 1.0, math.Inf(1), 1.0},
+		{vm.OP_SUB, 0.0, 0.0, 0.0},
+		{vm.OP_ADD, "1", int64(1), nil}, // coercion is left to run time
+		{vm.OP_BOR, 1.0, int64(1), nil},
+	} {
+		got, ok := fold(test.op, test.a, test.b)
+		if ok != (test.want != nil) || got != test.want {
+			t.Errorf("%s %v %v: got %v, %v, want %v", vm.Instruction(test.op).OpName(), test.a, test.b, got, ok, test.want)
+		}
+	}
+}
+
+func TestMoves(t *testing.T) {
+	p := &binary.Prototype{
+		MaxStackSize: 2,
+		Code: []vm.Instruction{
+			vm.CreateABC(vm.OP_MOVE, 0, 0, 0),   // 1
+			vm.CreateABC(vm.OP_MOVE, 1, 0, 0),   // 2
+			vm.CreateABC(vm.OP_MOVE, 0, 1, 0),   // 3
+			vm.CreateABC(vm.OP_TEST, 0, 0, 0),   // 4
+			vm.CreateAsBx(vm.OP_JMP, 0, 1),      // 5 -> 7
+			vm.CreateABC(vm.OP_MOVE, 1, 0, 0),   // 6
+			vm.CreateABC(vm.OP_MOVE, 0, 1, 0),   // 7
+			vm.CreateABC(vm.OP_RETURN, 0, 2, 0), // 8
+		},
+	}
+	stats := optimized(t, p)
+
+	want := strings.Join([]string{
+		"MOVE 1 0",
+		"TEST 0 0",
+		"JMP 0 1",
+		"MOVE 1 0",
+		"MOVE 0 1",
+		"RETURN 0 2",
+	}, "\n")
+	if got := listing(p); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if stats.Moves != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestLoadNil(t *testing.T) {
+	p := &binary.Prototype{
+		MaxStackSize: 6,
+		Code: []vm.Instruction{
+			vm.CreateABC(vm.OP_LOADNIL, 0, 1, 0), // 1
+			vm.CreateABC(vm.OP_LOADNIL, 2, 0, 0), // 2
+			vm.CreateABC(vm.OP_LOADNIL, 1, 2, 0), // 3
+			vm.CreateABC(vm.OP_LOADNIL, 5, 0, 0), // 4
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),  // 5
+		},
+		LineInfo: []uint32{1, 2, 3, 4, 5},
+		LocVars: []binary.LocVar{
+			{VarName: "a", StartPC: 1, EndPC: 5},
+			{VarName: "b", StartPC: 2, EndPC: 5},
+			{VarName: "c", StartPC: 4, EndPC: 5},
+		},
+	}
+	stats := optimized(t, p)
+
+	want := "LOADNIL 0 3\nLOADNIL 5 0\nRETURN 0 1"
+	if got := listing(p); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if !reflect.DeepEqual(p.LineInfo, []uint32{1, 4, 5}) {
+		t.Errorf("unexpected line info %v", p.LineInfo)
+	}
+	wantVars := []binary.LocVar{
+		{VarName: "a", StartPC: 1, EndPC: 3},
+		{VarName: "b", StartPC: 1, EndPC: 3},
+		{VarName: "c", StartPC: 2, EndPC: 3},
+	}
+	if !reflect.DeepEqual(p.LocVars, wantVars) {
+		t.Errorf("got locals %v, want %v", p.LocVars, wantVars)
+	}
+	if stats.Nils != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestNested(t *testing.T) {
+	inner := &binary.Prototype{
+		MaxStackSize: 1,
+		Code: []vm.Instruction{
+			vm.CreateABC(vm.OP_MOVE, 0, 0, 0),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+	}
+	p := &binary.Prototype{
+		MaxStackSize: 1,
+		Code: []vm.Instruction{
+			vm.CreateABx(vm.OP_CLOSURE, 0, 0),
+			vm.CreateABC(vm.OP_RETURN, 0, 1, 0),
+		},
+		Protos: []*binary.Prototype{inner},
+	}
+	if stats := optimized(t, p); stats.Moves != 1 || len(inner.Code) != 1 {
+		t.Errorf("nested function not optimized: %+v", stats)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, test := range []struct {
+		i    vm.Instruction
+		want string
+	}{
+		{vm.CreateABC(vm.OP_MOVE, 2, 0, 0), "main: [1] MOVE: register 2 out of range"},
+		{vm.CreateABC(vm.OP_ADD, 0, 0x100, 3), "main: [1] ADD: register 3 out of range"},
+		{vm.CreateABC(vm.OP_EQ, 0, 0x101, 0), "main: [1] EQ: constant 1 out of range"},
+		{vm.CreateABx(vm.OP_LOADK, 0, 1), "main: [1] LOADK: constant 1 out of range"},
+		{vm.CreateABx(vm.OP_CLOSURE, 0, 0), "main: [1] CLOSURE: function 0 out of range"},
+		{vm.CreateAsBx(vm.OP_JMP, 0, 1), "main: [1] JMP: jump to 3 out of range"},
+		{vm.CreateAsBx(vm.OP_FORLOOP, 0, -2), "main: [1] FORLOOP: jump to 0 out of range"},
+		{vm.CreateABC(vm.OP_LOADNIL, 1, 1, 0), "main: [1] LOADNIL: register 2 out of range"},
+		{vm.CreateABx(vm.OP_LOADKX, 0, 0), "main: [1] LOADKX: not followed by EXTRAARG"},
+		{vm.CreateABC(vm.OP_SETTABLE, 2, 0, 0), "main: [1] SETTABLE: register 2 out of range"},
+		{vm.CreateABC(vm.OP_SETUPVAL, 2, 0, 0), "main: [1] SETUPVAL: register 2 out of range"},
+		{vm.CreateABC(vm.OP_SETUPVAL, 0, 1, 0), "main: [1] SETUPVAL: upvalue 1 out of range"},
+		{vm.CreateABC(vm.OP_GETUPVAL, 0, 1, 0), "main: [1] GETUPVAL: upvalue 1 out of range"},
+		{vm.CreateABC(vm.OP_SETTABUP, 1, 0x100, 0x100), "main: [1] SETTABUP: upvalue 1 out of range"},
+		{vm.CreateABC(vm.OP_TEST, 2, 0, 0), "main: [1] TEST: register 2 out of range"},
+		{vm.CreateABC(vm.OP_SELF, 1, 0, 0x100), "main: [1] SELF: register 2 out of range"},
+		{vm.CreateABC(vm.OP_CALL, 0, 3, 1), "main: [1] CALL: register 2 out of range"},
+		{vm.CreateABC(vm.OP_CALL, 1, 1, 3), "main: [1] CALL: register 2 out of range"},
+		{vm.CreateABC(vm.OP_TAILCALL, 1, 2, 0), "main: [1] TAILCALL: register 2 out of range"},
+		{vm.CreateABC(vm.OP_RETURN, 1, 3, 0), "main: [1] RETURN: register 2 out of range"},
+		{vm.CreateABC(vm.OP_RETURN, 2, 0, 0), "main: [1] RETURN: register 2 out of range"},
+		{vm.CreateABC(vm.OP_VARARG, 0, 4, 0), "main: [1] VARARG: register 2 out of range"},
+		{vm.CreateAsBx(vm.OP_FORPREP, 0, 0), "main: [1] FORPREP: register 3 out of range"},
+		{vm.CreateAsBx(vm.OP_FORLOOP, 0, 0), "main: [1] FORLOOP: register 3 out of range"},
+		{vm.CreateABC(vm.OP_TFORCALL, 0, 0, 1), "main: [1] TFORCALL: register 3 out of range"},
+		{vm.CreateAsBx(vm.OP_TFORLOOP, 1, 0), "main: [1] TFORLOOP: register 2 out of range"},
+		{vm.CreateABC(vm.OP_SETLIST, 0, 2, 1), "main: [1] SETLIST: register 2 out of range"},
+		{vm.CreateABC(vm.OP_SETLIST, 0, 1, 0), "main: [1] SETLIST: not followed by EXTRAARG"},
+		{vm.CreateAsBx(vm.OP_JMP, 3, 0), "main: [1] JMP: register 2 out of range"},
+	} {
+		p := &binary.Prototype{
+			MaxStackSize: 2,
+			Code:         []vm.Instruction{test.i, vm.CreateABC(vm.OP_RETURN, 0, 1, 0)},
+			Constants:    []interface{}{int64(1)},
+			Upvalues:     []binary.Upvalue{{InStack: 1, Idx: 0}},
+		}
+		err := Check(p)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%s: got %v, want %s", test.i, err, test.want)
+		}
+		if _, err := Optimize(p); err == nil {
+			t.Errorf("%s: malformed function optimized", test.i)
+		}
+	}
+
+	// upvalues of a nested function refer to the registers and upvalues of its parent
+	for _, u := range []binary.Upvalue{{InStack: 1, Idx: 2}, {InStack: 0, Idx: 1}} {
+		p := &binary.Prototype{
+			MaxStackSize: 2,
+			Code:         []vm.Instruction{vm.CreateABx(vm.OP_CLOSURE, 0, 0), vm.CreateABC(vm.OP_RETURN, 0, 1, 0)},
+			Upvalues:     []binary.Upvalue{{InStack: 1, Idx: 0}},
+			Protos: []*binary.Prototype{{MaxStackSize: 2, Upvalues: []binary.Upvalue{u},
+				Code: []vm.Instruction{vm.CreateABC(vm.OP_RETURN, 0, 1, 0)}}},
+		}
+		if err := Check(p); err == nil {
+			t.Errorf("CLOSURE with upvalue %+v accepted", u)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/uganh16/luago/binary"
+	"github.com/uganh16/luago/vm"
+)
+
+func printFunction(p *binary.Prototype, full bool, files sourceFiles) {
+	printHeader(p)
+	printCode(p, files)
+	if full {
+		printDebug(p)
+	}
+	for _, p := range p.Protos {
+		printFunction(p, full, files)
+	}
+}
+
+func printHeader(p *binary.Prototype) {
+	source := sourceName(p)
+
+	varargFlag := ""
+	if p.IsVararg {
+		varargFlag = "+"
+	}
+
+	fmt.Printf("\n%s <%s:%d,%d> (%d instruction%s)\n", funcType(p), source, p.LineDefined, p.LastLineDefined, len(p.Code), ss(len(p.Code)))
+	fmt.Printf("%d%s param%s, %d slot%s, %d upvalue%s, %d local%s, %d constant%s, %d function%s\n", p.NumParams, varargFlag, ss(int(p.NumParams)), p.MaxStackSize, ss(int(p.MaxStackSize)), len(p.Upvalues), ss(len(p.Upvalues)), len(p.LocVars), ss(len(p.LocVars)), len(p.Constants), ss(len(p.Constants)), len(p.Protos), ss(len(p.Protos)))
+}
+
+func printCode(p *binary.Prototype, files sourceFiles) {
+	src := newSourceLines(p, files)
+	for pc, i := range p.Code {
+		if src != nil && len(p.LineInfo) > pc {
+			src.printUpTo(int(p.LineInfo[pc]))
+		}
+		line := "-"
+		if len(p.LineInfo) > pc {
+			line = fmt.Sprintf("%d", p.LineInfo[pc])
+		}
+		op, operands, _ := strings.Cut(i.String(), " ")
+		fmt.Printf("\t%d\t[%s]\t%-9s\t%s", pc+1, line, op, operands)
+		if annotating {
+			if comments := annotate(p, pc); len(comments) > 0 {
+				fmt.Printf("\t; %s", strings.Join(comments, "; "))
+			}
+		}
+		fmt.Printf("\n")
+	}
+	if src != nil {
+		src.printUpTo(src.last)
+	}
+}
+
+/* lines of the source files read for a listing, by path */
+type sourceFiles map[string][]string
+
+/* the lines of a source file, or nil if it cannot be read */
+func (files sourceFiles) lines(path string) []string {
+	lines, ok := files[path]
+	if !ok {
+		if data, err := os.ReadFile(path); err == nil {
+			text := strings.ReplaceAll(string(data), "\r\n", "\n")
+			lines = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+		}
+		files[path] = lines
+	}
+	return lines
+}
+
+/* source lines of a function, printed in step with its instructions */
+type sourceLines struct {
+	lines []string
+	next  int // first line not printed yet
+	last  int // last line of the function
+	cur   int // line of the instructions being listed
+}
+
+func newSourceLines(p *binary.Prototype, files sourceFiles) *sourceLines {
+	if !interleaving {
+		return nil
+	}
+	path := sourceFile
+	if path == "" {
+		if p.Source == "" || p.Source[0] != '@' {
+			return nil
+		}
+		path = p.Source[1:]
+	}
+	lines := files.lines(path)
+	if lines == nil {
+		return nil
+	}
+	src := &sourceLines{lines: lines, next: int(p.LineDefined), last: int(p.LastLineDefined)}
+	if p.LineDefined == 0 { // main chunk spans the whole file
+		src.next, src.last = 1, len(lines)
+	}
+	return src
+}
+
+/* print the source lines up to line not printed yet, or line again if the line info went back */
+func (src *sourceLines) printUpTo(line int) {
+	if line == src.cur {
+		return
+	}
+	src.cur = line
+	if line < src.next {
+		src.printLine(line)
+		return
+	}
+	for ; src.next <= line && src.next <= src.last; src.next++ {
+		src.printLine(src.next)
+	}
+}
+
+func (src *sourceLines) printLine(line int) {
+	if 0 < line && line <= len(src.lines) {
+		fmt.Printf("--%4d: %s\n", line, src.lines[line-1])
+	}
+}
+
+/* trailing comments for the instruction at pc, after luac's */
+func annotate(p *binary.Prototype, pc int) []string {
+	var comments []string
+	comment := func(format string, a ...any) {
+		comments = append(comments, fmt.Sprintf(format, a...))
+	}
+	rk := func(x int) string {
+		if x > 0xff {
+			return constantString(p, x&0xff)
+		}
+		return "-"
+	}
+
+	i := p.Code[pc]
+	a, b, c := i.ABC()
+	switch i.Opcode() {
+	case vm.OP_LOADK:
+		_, bx := i.ABx()
+		comment("%s", constantString(p, bx))
+	case vm.OP_GETUPVAL, vm.OP_SETUPVAL:
+		comment("%s", upvalueName(p, b))
+	case vm.OP_GETTABUP:
+		if c > 0xff {
+			comment("%s %s", upvalueName(p, b), rk(c))
+		} else {
+			comment("%s", upvalueName(p, b))
+		}
+	case vm.OP_SETTABUP:
+		s := upvalueName(p, a)
+		if b > 0xff {
+			s += " " + rk(b)
+		}
+		if c > 0xff {
+			s += " " + rk(c)
+		}
+		comment("%s", s)
+	case vm.OP_GETTABLE, vm.OP_SELF:
+		if c > 0xff {
+			comment("%s", rk(c))
+		}
+	case vm.OP_SETTABLE, vm.OP_ADD, vm.OP_SUB, vm.OP_MUL, vm.OP_MOD, vm.OP_POW,
+		vm.OP_DIV, vm.OP_IDIV, vm.OP_BAND, vm.OP_BOR, vm.OP_BXOR, vm.OP_SHL, vm.OP_SHR,
+		vm.OP_EQ, vm.OP_LT, vm.OP_LE:
+		if b > 0xff || c > 0xff {
+			comment("%s %s", rk(b), rk(c))
+		}
+	case vm.OP_JMP, vm.OP_FORLOOP, vm.OP_FORPREP, vm.OP_TFORLOOP:
+		_, sbx := i.AsBx()
+		comment("to %d", sbx+pc+2)
+	case vm.OP_CLOSURE:
+		_, bx := i.ABx()
+		if bx < len(p.Protos) {
+			q := p.Protos[bx]
+			comment("%s <%s:%d,%d>", funcType(q), sourceName(q), q.LineDefined, q.LastLineDefined)
+		}
+	case vm.OP_SETLIST:
+		if c == 0 && pc+1 < len(p.Code) {
+			comment("%d", p.Code[pc+1].Ax()) // the count is in the EXTRAARG
+		} else {
+			comment("%d", c)
+		}
+	case vm.OP_EXTRAARG:
+		if pc > 0 && p.Code[pc-1].Opcode() == vm.OP_LOADKX {
+			comment("%s", constantString(p, i.Ax()))
+		}
+	}
+
+	var locals []string
+	for _, locVar := range p.LocVars {
+		if int(locVar.StartPC) <= pc && pc < int(locVar.EndPC) {
+			locals = append(locals, locVar.VarName)
+		}
+	}
+	if len(locals) > 0 {
+		comment("locals: %s", strings.Join(locals, " "))
+	}
+	return comments
+}
+
+func printDebug(p *binary.Prototype) {
+	fmt.Printf("constants (%d):\n", len(p.Constants))
+	for i := range p.Constants {
+		fmt.Printf("\t%d\t%s\n", i+1, constantString(p, i))
+	}
+
+	fmt.Printf("locals (%d):\n", len(p.LocVars))
+	for i, locVar := range p.LocVars {
+		fmt.Printf("\t%d\t%s\t%d\t%d\n", i, locVar.VarName, locVar.StartPC+1, locVar.EndPC+1)
+	}
+
+	fmt.Printf("upvalues (%d):\n", len(p.Upvalues))
+	for i, upvalue := range p.Upvalues {
+		fmt.Printf("\t%d\t%s\t%d\t%d\n", i, upvalueName(p, i), upvalue.InStack, upvalue.Idx)
+	}
+}
+
+func funcType(p *binary.Prototype) string {
+	if p.LineDefined > 0 {
+		return "function"
+	}
+	return "main"
+}
+
+func sourceName(p *binary.Prototype) string {
+	source := p.Source
+	if source == "" {
+		source = "=?"
+	}
+	if source[0] == '@' || source[0] == '=' {
+		return source[1:]
+	} else if source[0] == binary.LUA_SIGNATURE[0] {
+		return "(bstring)"
+	} else {
+		return "(string)"
+	}
+}
+
+func constantString(p *binary.Prototype, i int) string {
+	if i >= len(p.Constants) {
+		return "?"
+	}
+	return binary.ConstantString(p.Constants[i])
+}
+
+func upvalueName(p *binary.Prototype, i int) string {
+	if i < len(p.UpvalueNames) && p.UpvalueNames[i] != "" {
+		return p.UpvalueNames[i]
+	}
+	return "-"
+}
+
+func ss(n int) string {
+	if n != 1 {
+		return "s"
+	}
+	return ""
+}
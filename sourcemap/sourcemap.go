@@ -0,0 +1,220 @@
+package sourcemap
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/uganh16/luago/binary"
+)
+
+const header = "-- luago source map 1"
+
+/* debug information of one function, keyed by its path and the hash of its code */
+type Function struct {
+	Path         string // main, main/0, ...
+	Hash         string
+	Source       string
+	LineInfo     []uint32
+	LocVars      []binary.LocVar
+	UpvalueNames []string
+}
+
+/* debug information of a chunk, kept apart from it */
+type Map struct {
+	Functions []*Function
+}
+
+/* hash identifying the code of p */
+func Hash(p *binary.Prototype) string {
+	h := sha256.New()
+	for _, i := range p.Code {
+		h.Write([]byte{byte(i), byte(i >> 8), byte(i >> 16), byte(i >> 24)})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+/* the debug information of p and its nested functions */
+func Extract(p *binary.Prototype) *Map {
+	m := &Map{}
+	m.extract(p, "main")
+	return m
+}
+
+func (m *Map) extract(p *binary.Prototype, path string) {
+	m.Functions = append(m.Functions, &Function{
+		Path:         path,
+		Hash:         Hash(p),
+		Source:       p.Source,
+		LineInfo:     p.LineInfo,
+		LocVars:      p.LocVars,
+		UpvalueNames: p.UpvalueNames,
+	})
+	for i, proto := range p.Protos {
+		m.extract(proto, fmt.Sprintf("%s/%d", path, i))
+	}
+}
+
+func (m *Map) lookup(path string) *Function {
+	for _, f := range m.Functions {
+		if f.Path == path {
+			return f
+		}
+	}
+	return nil
+}
+
+/*
+ * put the debug information back into p and its nested functions, and
+ * return how many of them got it. Functions whose code changed since the
+ * map was extracted are left alone.
+ */
+func (m *Map) Attach(p *binary.Prototype) int {
+	return m.attach(p, "main")
+}
+
+func (m *Map) attach(p *binary.Prototype, path string) int {
+	n := 0
+	if f := m.lookup(path); f != nil && f.Hash == Hash(p) {
+		if f.Source != "" {
+			p.Source = f.Source
+		}
+		p.LineInfo, p.LocVars, p.UpvalueNames = f.LineInfo, f.LocVars, f.UpvalueNames
+		n++
+	}
+	for i, proto := range p.Protos {
+		n += m.attach(proto, fmt.Sprintf("%s/%d", path, i))
+	}
+	return n
+}
+
+/*
+ * source and line of the instruction at pc of the function at path; meant
+ * for the traceback formatter, which does not exist yet
+ */
+func (m *Map) Position(path string, pc int) (string, int, bool) {
+	f := m.lookup(path)
+	if f == nil || pc < 0 || pc >= len(f.LineInfo) {
+		return "", 0, false
+	}
+	return f.Source, int(f.LineInfo[pc]), true
+}
+
+/*
+ * write m as text, one directive per line:
+ *	function <path> <hash>
+ *	source <quoted name>	(if it differs from the previous function)
+ *	lines <first line> <delta>...
+ *	local <quoted name> <startpc> <endpc>
+ *	upvalue <quoted name>
+ */
+func (m *Map) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, header)
+	source := ""
+	for _, f := range m.Functions {
+		fmt.Fprintf(bw, "function %s %s\n", f.Path, f.Hash)
+		if f.Source != source {
+			fmt.Fprintf(bw, "source %s\n", strconv.Quote(f.Source))
+			source = f.Source
+		}
+		if len(f.LineInfo) > 0 {
+			bw.WriteString("lines")
+			prev := 0
+			for _, line := range f.LineInfo {
+				fmt.Fprintf(bw, " %d", int(line)-prev)
+				prev = int(line)
+			}
+			bw.WriteByte('\n')
+		}
+		for _, locVar := range f.LocVars {
+			fmt.Fprintf(bw, "local %s %d %d\n", strconv.Quote(locVar.VarName), locVar.StartPC, locVar.EndPC)
+		}
+		for _, name := range f.UpvalueNames {
+			fmt.Fprintf(bw, "upvalue %s\n", strconv.Quote(name))
+		}
+	}
+	return bw.Flush()
+}
+
+func Read(r io.Reader) (*Map, error) {
+	m := &Map{}
+	br := bufio.NewReader(r) // lines grow with the size of a function
+	n := 0
+	source := ""
+	var f *Function
+	for {
+		line, readErr := br.ReadString('\n')
+		if readErr == io.EOF && line == "" {
+			break
+		} else if readErr != nil && readErr != io.EOF {
+			return nil, readErr
+		}
+		n++
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if n == 1 {
+			if line != header {
+				return nil, fmt.Errorf("not a source map")
+			}
+			continue
+		}
+		directive, args, _ := strings.Cut(line, " ")
+		if f == nil && directive != "function" {
+			return nil, fmt.Errorf("line %d: '%s' outside of a function", n, directive)
+		}
+		var err error
+		switch directive {
+		case "function":
+			f = &Function{Source: source}
+			if _, err = fmt.Sscanf(args, "%s %s", &f.Path, &f.Hash); err == nil {
+				m.Functions = append(m.Functions, f)
+			}
+		case "source":
+			f.Source, err = strconv.Unquote(args)
+			source = f.Source
+		case "lines":
+			line := 0
+			for _, field := range strings.Fields(args) {
+				var delta int
+				if delta, err = strconv.Atoi(field); err != nil {
+					break
+				}
+				line += delta
+				f.LineInfo = append(f.LineInfo, uint32(line))
+			}
+		case "local":
+			var locVar binary.LocVar
+			if locVar.VarName, args, err = unquotePrefix(args); err == nil {
+				_, err = fmt.Sscanf(args, "%d %d", &locVar.StartPC, &locVar.EndPC)
+			}
+			f.LocVars = append(f.LocVars, locVar)
+		case "upvalue":
+			var name string
+			name, err = strconv.Unquote(args)
+			f.UpvalueNames = append(f.UpvalueNames, name)
+		default:
+			err = fmt.Errorf("unknown directive '%s'", directive)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("not a source map")
+	}
+	return m, nil
+}
+
+/* the quoted string at the start of s, and the rest of s */
+func unquotePrefix(s string) (string, string, error) {
+	q, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return "", "", err
+	}
+	u, err := strconv.Unquote(q)
+	return u, s[len(q):], err
+}
@@ -0,0 +1,78 @@
+package sourcemap
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/uganh16/luago/binary"
+	"github.com/uganh16/luago/vm"
+)
+
+func chunk() *binary.Prototype {
+	ret := vm.CreateABC(vm.OP_RETURN, 0, 1, 0)
+	inner := &binary.Prototype{Source: "@f.lua", LineDefined: 3, Code: []vm.Instruction{vm.CreateABC(vm.OP_GETUPVAL, 0, 0, 0), ret},
+		LineInfo: []uint32{4, 5}, Upvalues: []binary.Upvalue{{InStack: 1, Idx: 0}}, UpvalueNames: []string{"a b"}}
+	return &binary.Prototype{Source: "@f.lua", Code: []vm.Instruction{vm.CreateABx(vm.OP_CLOSURE, 1, 0), ret},
+		LineInfo: []uint32{6, 1}, LocVars: []binary.LocVar{{VarName: "x", StartPC: 0, EndPC: 2}, {VarName: "(for index)", StartPC: 1, EndPC: 2}},
+		Protos: []*binary.Prototype{inner}, UpvalueNames: []string{"_ENV"}}
+}
+
+func TestRoundTrip(t *testing.T) {
+	var sb strings.Builder
+	if err := Extract(chunk()).Write(&sb); err != nil {
+		t.Fatal(err)
+	}
+	m, err := Read(strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := chunk()
+	binary.Strip(p, binary.STRIP_ALL)
+	p.Protos[0].Code[0] = vm.CreateABC(vm.OP_GETUPVAL, 1, 0, 0) // changed since
+	if n := m.Attach(p); n != 1 {
+		t.Errorf("attached to %d functions, want 1", n)
+	}
+	if want := chunk(); !reflect.DeepEqual(p.LineInfo, want.LineInfo) || !reflect.DeepEqual(p.LocVars, want.LocVars) ||
+		!reflect.DeepEqual(p.UpvalueNames, want.UpvalueNames) || p.Source != want.Source {
+		t.Errorf("debug information not restored:\n%s", sb.String())
+	}
+	if p.Protos[0].LineInfo != nil {
+		t.Errorf("debug information attached to changed code")
+	}
+
+	if source, line, ok := m.Position("main/0", 1); !ok || source != "@f.lua" || line != 5 {
+		t.Errorf("got position %s:%d (%t), want @f.lua:5", source, line, ok)
+	}
+	if _, _, ok := m.Position("main/1", 0); ok {
+		t.Errorf("position of missing function")
+	}
+}
+
+func TestRoundTripLarge(t *testing.T) {
+	p := &binary.Prototype{Source: "@big.lua", Code: make([]vm.Instruction, 40000), LineInfo: make([]uint32, 40000)}
+	for pc := range p.Code {
+		p.Code[pc] = vm.CreateABC(vm.OP_RETURN, 0, 1, 0)
+		p.LineInfo[pc] = uint32(1 + pc*7%1000)
+	}
+	var sb strings.Builder
+	if err := Extract(p).Write(&sb); err != nil {
+		t.Fatal(err)
+	}
+	m, err := Read(strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Functions) != 1 || !reflect.DeepEqual(m.Functions[0].LineInfo, p.LineInfo) {
+		t.Errorf("line information of a large function not read back")
+	}
+}
+
+func TestRead(t *testing.T) {
+	for _, s := range []string{"", "function main 0\n", header + "\nlines 1\n", header + "\nfunction main 0\nlocal x 1 2\n"} {
+		if _, err := Read(strings.NewReader(s)); err == nil {
+			t.Errorf("no error reading %q", s)
+		}
+	}
+}
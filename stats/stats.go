@@ -0,0 +1,176 @@
+package stats
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/uganh16/luago/binary"
+	"github.com/uganh16/luago/vm"
+)
+
+/* figures for a single function */
+type Function struct {
+	File         string
+	Path         string // main, main/0, ...
+	Depth        int    // nesting depth, 0 for main
+	Instructions int
+	MaxStackSize int
+	Constants    int
+	Upvalues     int
+	Closures     int // functions defined directly inside this one
+	Opcodes      map[string]int
+	Strings      []string // string constants
+}
+
+/* figures for a collection of chunks */
+type Report struct {
+	Files     []string
+	Functions []*Function
+}
+
+func (r *Report) Add(file string, p *binary.Prototype) {
+	r.Files = append(r.Files, file)
+	r.add(file, "main", 0, p)
+}
+
+func (r *Report) add(file, path string, depth int, p *binary.Prototype) {
+	f := &Function{
+		File:         file,
+		Path:         path,
+		Depth:        depth,
+		Instructions: len(p.Code),
+		MaxStackSize: int(p.MaxStackSize),
+		Constants:    len(p.Constants),
+		Upvalues:     len(p.Upvalues),
+		Closures:     len(p.Protos),
+		Opcodes:      map[string]int{},
+	}
+	for _, i := range p.Code {
+		f.Opcodes[i.OpName()]++
+	}
+	for _, k := range p.Constants {
+		if s, ok := k.(string); ok {
+			f.Strings = append(f.Strings, s)
+		}
+	}
+	r.Functions = append(r.Functions, f)
+	for i, proto := range p.Protos {
+		r.add(file, fmt.Sprintf("%s/%d", path, i), depth+1, proto)
+	}
+}
+
+/* opcode names with their number of uses, most used first */
+func (r *Report) Opcodes() ([]string, map[string]int) {
+	counts := map[string]int{}
+	for _, f := range r.Functions {
+		for op, n := range f.Opcodes {
+			counts[op] += n
+		}
+	}
+	var ops []string
+	for op := range counts {
+		ops = append(ops, op)
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if counts[ops[i]] != counts[ops[j]] {
+			return counts[ops[i]] > counts[ops[j]]
+		}
+		return ops[i] < ops[j]
+	})
+	return ops, counts
+}
+
+/* string constants held by more than one function with their number of copies, most bytes wasted first */
+func (r *Report) Duplicates() ([]string, map[string]int) {
+	counts := map[string]int{}
+	for _, f := range r.Functions {
+		for _, s := range f.Strings {
+			counts[s]++
+		}
+	}
+	var dups []string
+	for s, n := range counts {
+		if n > 1 {
+			dups = append(dups, s)
+		}
+	}
+	wasted := func(s string) int {
+		return len(s) * (counts[s] - 1)
+	}
+	sort.Slice(dups, func(i, j int) bool {
+		if wasted(dups[i]) != wasted(dups[j]) {
+			return wasted(dups[i]) > wasted(dups[j])
+		}
+		return dups[i] < dups[j]
+	})
+	return dups, counts
+}
+
+func (r *Report) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	instructions, upvalues, closures, depth := 0, 0, 0, 0
+	for _, f := range r.Functions {
+		instructions += f.Instructions
+		upvalues += f.Upvalues
+		closures += f.Closures
+		if f.Depth > depth {
+			depth = f.Depth
+		}
+	}
+	fmt.Fprintf(bw, "%d file%s, %d function%s, %d instruction%s, %d closure%s, %d upvalue%s, deepest nesting %d\n",
+		len(r.Files), ss(len(r.Files)), len(r.Functions), ss(len(r.Functions)), instructions, ss(instructions),
+		closures, ss(closures), upvalues, ss(upvalues), depth)
+
+	fmt.Fprintf(bw, "\nopcodes:\n")
+	ops, counts := r.Opcodes()
+	for _, op := range ops {
+		fmt.Fprintf(bw, "\t%-9s\t%d\t%5.1f%%\n", op, counts[op], 100*float64(counts[op])/float64(instructions))
+	}
+
+	fmt.Fprintf(bw, "\nfunctions:\n\tinstrs\tstack\tconsts\tupvals\tclosures\tfunction\n")
+	for _, f := range r.Functions {
+		fmt.Fprintf(bw, "\t%d\t%d\t%d\t%d\t%d\t%s:%s\n",
+			f.Instructions, f.MaxStackSize, f.Constants, f.Upvalues, f.Closures, f.File, f.Path)
+	}
+
+	if dups, copies := r.Duplicates(); len(dups) > 0 {
+		fmt.Fprintf(bw, "\nduplicated string constants:\n\tcopies\tbytes\tstring\n")
+		for _, s := range dups {
+			fmt.Fprintf(bw, "\t%d\t%d\t%q\n", copies[s], len(s)*copies[s], s)
+		}
+	}
+	return bw.Flush()
+}
+
+/* one record per function, with a column for each opcode */
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := []string{"file", "function", "depth", "instructions", "maxstacksize", "constants", "upvalues", "closures"}
+	for op := vm.OP_MOVE; op <= vm.OP_EXTRAARG; op++ {
+		header = append(header, vm.Instruction(op).OpName())
+	}
+	cw.Write(header)
+	for _, f := range r.Functions {
+		record := []string{f.File, f.Path}
+		for _, n := range []int{f.Depth, f.Instructions, f.MaxStackSize, f.Constants, f.Upvalues, f.Closures} {
+			record = append(record, strconv.Itoa(n))
+		}
+		for _, op := range header[len(record):] {
+			record = append(record, strconv.Itoa(f.Opcodes[op]))
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func ss(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
@@ -0,0 +1,44 @@
+package stats
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/uganh16/luago/binary"
+	"github.com/uganh16/luago/vm"
+)
+
+func TestReport(t *testing.T) {
+	ret := vm.CreateABC(vm.OP_RETURN, 0, 1, 0)
+	inner := &binary.Prototype{Code: []vm.Instruction{ret}, Constants: []interface{}{"print", "x"}}
+	main := &binary.Prototype{
+		MaxStackSize: 2,
+		Code:         []vm.Instruction{vm.CreateABx(vm.OP_CLOSURE, 0, 0), ret},
+		Constants:    []interface{}{"print", int64(1)},
+		Protos:       []*binary.Prototype{inner},
+	}
+	r := &Report{}
+	r.Add("a.luac", main)
+	r.Add("b.luac", inner)
+
+	if len(r.Functions) != 3 || r.Functions[1].Path != "main/0" || r.Functions[1].Depth != 1 {
+		t.Fatalf("unexpected functions: %+v", r.Functions)
+	}
+	ops, counts := r.Opcodes()
+	if ops[0] != "RETURN" || counts["RETURN"] != 3 || counts["CLOSURE"] != 1 {
+		t.Errorf("unexpected opcodes: %v %v", ops, counts)
+	}
+	dups, copies := r.Duplicates()
+	if len(dups) != 2 || dups[0] != "print" || copies["print"] != 3 || copies["x"] != 2 {
+		t.Errorf("unexpected duplicates: %v %v", dups, copies)
+	}
+
+	var sb strings.Builder
+	if err := r.WriteCSV(&sb); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(sb.String(), "\n")
+	if len(lines) != 5 || !strings.HasPrefix(lines[1], "a.luac,main,0,2,2,2,0,1,") {
+		t.Errorf("unexpected CSV:\n%s", sb.String())
+	}
+}
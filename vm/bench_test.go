@@ -0,0 +1,29 @@
+package vm
+
+import "testing"
+
+func BenchmarkForLoop(b *testing.B) {
+	for _, bench := range []struct {
+		name              string
+		init, limit, step interface{}
+	}{
+		{"int", int64(1), int64(1000), int64(1)},
+		{"float", 1.0, 1000.0, 1.0},
+		{"clipped", int64(1), 1000.5, int64(1)},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				loop, err := ForPrep(bench.init, bench.limit, bench.step)
+				if err != nil {
+					b.Fatal(err)
+				}
+				for {
+					if _, ok := loop.Next(); !ok {
+						break
+					}
+				}
+			}
+		})
+	}
+}
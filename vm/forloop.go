@@ -0,0 +1,135 @@
+package vm
+
+import (
+	"errors"
+
+	"github.com/uganh16/luago/number"
+)
+
+/*
+ * control state of a numeric for loop, kept by FORPREP and FORLOOP in
+ * R(A)..R(A+2). Integer loops count their iterations in advance, so they
+ * never overflow even when the limit is near math.maxinteger.
+ */
+type ForLoop struct {
+	isInt   bool
+	started bool
+
+	i, step int64
+	count   uint64 // iterations left after the current one
+	forever bool   // zero step with the limit reached: loops forever
+
+	f, limit, fstep float64
+}
+
+/*
+ * FORPREP: prepare a loop over init, limit and step, following Lua 5.3
+ * except that integer loops never wrap around (as in 5.4). The loop is
+ * over integers when init and step are integers and limit is a number (a
+ * float limit is clipped), over floats otherwise.
+ */
+func ForPrep(init, limit, step interface{}) (*ForLoop, error) {
+	if i, ok := init.(int64); ok {
+		if s, ok := step.(int64); ok {
+			if l, skip, ok := forLimit(limit, s); ok {
+				return intLoop(i, l, s, skip), nil
+			}
+		}
+	}
+
+	loop := &ForLoop{}
+	var ok bool
+	if loop.limit, ok = toNumber(limit); !ok {
+		return nil, errors.New("'for' limit must be a number")
+	}
+	if loop.fstep, ok = toNumber(step); !ok {
+		return nil, errors.New("'for' step must be a number")
+	}
+	if loop.f, ok = toNumber(init); !ok {
+		return nil, errors.New("'for' initial value must be a number")
+	}
+	loop.f -= loop.fstep // FORLOOP adds it back first
+	return loop, nil
+}
+
+func intLoop(i, limit, step int64, skip bool) *ForLoop {
+	loop := &ForLoop{isInt: true, i: i, step: step}
+	switch {
+	case skip:
+		loop.started = true // nothing to run
+	case step == 0:
+		// 5.3 keeps checking 'limit <= i' without ever moving i
+		loop.forever = limit <= i
+		loop.started = !loop.forever
+	case step > 0 && i > limit, step < 0 && i < limit:
+		loop.started = true
+	case step > 0:
+		loop.count = (uint64(limit) - uint64(i)) / uint64(step)
+	default:
+		// step+1 avoids negating math.mininteger
+		loop.count = (uint64(i) - uint64(limit)) / (uint64(-(step + 1)) + 1)
+	}
+	return loop
+}
+
+/* FORLOOP: the next value of the control variable, or false when the loop is over */
+func (loop *ForLoop) Next() (interface{}, bool) {
+	if loop.isInt {
+		switch {
+		case !loop.started:
+			loop.started = true
+		case loop.forever:
+		case loop.count > 0:
+			loop.count--
+			loop.i += loop.step
+		default:
+			return nil, false
+		}
+		return loop.i, true
+	}
+
+	loop.f += loop.fstep
+	if 0 < loop.fstep && loop.f <= loop.limit || loop.fstep <= 0 && loop.limit <= loop.f {
+		return loop.f, true
+	}
+	return nil, false
+}
+
+/* whether the loop is over integers */
+func (loop *ForLoop) IsInteger() bool {
+	return loop.isInt
+}
+
+/* integer limit of a loop with an integer step, and whether to skip the loop (forlimit) */
+func forLimit(limit interface{}, step int64) (int64, bool, bool) {
+	switch l := limit.(type) {
+	case int64:
+		return l, false, true
+	case float64:
+		i, skip := number.ForLimit(l, step)
+		return i, skip, true
+	case string:
+		if i, ok := number.ParseInteger(l); ok {
+			return i, false, true
+		}
+		if f, ok := number.ParseFloat(l); ok {
+			return forLimit(f, step)
+		}
+	}
+	return 0, false, false
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		if i, ok := number.ParseInteger(v); ok {
+			return float64(i), true
+		}
+		return number.ParseFloat(v)
+	}
+	return 0, false
+}
@@ -0,0 +1,98 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/uganh16/luago/number"
+)
+
+/* values of the control variable, up to max of them, or the error message */
+func run(init, limit, step interface{}, max int) string {
+	loop, err := ForPrep(init, limit, step)
+	if err != nil {
+		return err.Error()
+	}
+	s := ""
+	for n := 0; n < max; n++ {
+		v, ok := loop.Next()
+		if !ok {
+			return s
+		}
+		switch v := v.(type) {
+		case int64:
+			s += fmt.Sprintf("%d ", v)
+		case float64:
+			s += number.FloatToString(v) + " "
+		}
+	}
+	return s + "..."
+}
+
+/*
+ * expected results follow the reference implementation (lvm.c, Lua 5.3),
+ * except near the integer bounds: there 5.3 lets the control variable wrap
+ * around and keeps looping, while these loops stop at the limit as in 5.4
+ */
+func TestForLoop(t *testing.T) {
+	const maxint, minint = math.MaxInt64, math.MinInt64
+	tests := []struct {
+		init, limit, step interface{}
+		want              string
+	}{
+		{int64(1), int64(3), int64(1), "1 2 3 "},
+		{int64(3), int64(1), int64(-1), "3 2 1 "},
+		{int64(1), int64(0), int64(1), ""},
+		{int64(0), int64(1), int64(-1), ""},
+		{int64(1), int64(7), int64(3), "1 4 7 "},
+		{int64(1), int64(8), int64(3), "1 4 7 "},
+
+		// float limits are clipped
+		{int64(1), 3.5, int64(1), "1 2 3 "},
+		{int64(3), 1.5, int64(-1), "3 2 "},
+		{int64(1), 1e100, int64(1), "1 2 3 4 ..."},
+		{int64(1), -1e100, int64(1), ""},
+		{int64(1), -1e100, int64(-1), "1 0 -1 -2 ..."},
+		{int64(1), 1e100, int64(-1), ""},
+		{int64(1), math.NaN(), int64(1), ""},
+
+		// no overflow near the integer bounds (5.4 semantics; 5.3 wraps around)
+		{int64(maxint - 2), int64(maxint), int64(1), "9223372036854775805 9223372036854775806 9223372036854775807 "},
+		{int64(minint + 2), int64(minint), int64(-1), "-9223372036854775806 -9223372036854775807 -9223372036854775808 "},
+		{int64(1), int64(3), int64(maxint), "1 "},
+		{int64(0), int64(minint), int64(minint), "0 -9223372036854775808 "},
+		{int64(maxint), 1e100, int64(1), "9223372036854775807 "},
+		{int64(minint), int64(maxint), int64(maxint), "-9223372036854775808 -1 9223372036854775806 "},
+
+		// zero step: the limit is checked but the variable never moves
+		{int64(1), int64(1), int64(0), "1 1 1 1 ..."},
+		{int64(1), int64(2), int64(0), ""},
+		{1.0, 1.0, 0.0, "1.0 1.0 1.0 1.0 ..."},
+
+		// float loops
+		{1.0, int64(3), int64(1), "1.0 2.0 3.0 "},
+		{int64(1), int64(2), 0.5, "1.0 1.5 2.0 "},
+		{0.1, 0.35, 0.1, "0.1 0.2 0.3 "},
+		{int64(2), 1.0, -0.5, "2.0 1.5 1.0 "},
+		{math.Inf(-1), int64(0), int64(1), "-inf -inf -inf -inf ..."},
+
+		// string coercions
+		{"1", int64(2), int64(1), "1.0 2.0 "},
+		{int64(1), "2", int64(1), "1 2 "},
+		{int64(1), " 0x2 ", int64(1), "1 2 "},
+		{int64(1), "2.5", int64(1), "1 2 "},
+
+		// errors, the limit being checked first
+		{int64(1), nil, int64(1), "'for' limit must be a number"},
+		{int64(1), "x", int64(1), "'for' limit must be a number"},
+		{int64(1), int64(2), nil, "'for' step must be a number"},
+		{nil, int64(2), int64(1), "'for' initial value must be a number"},
+		{true, nil, false, "'for' limit must be a number"},
+	}
+	for _, test := range tests {
+		if got := run(test.init, test.limit, test.step, 4); got != test.want {
+			t.Errorf("for i = %#v, %#v, %#v: got %q, want %q", test.init, test.limit, test.step, got, test.want)
+		}
+	}
+}
@@ -1,10 +1,28 @@
 package vm
 
+import "fmt"
+
 type Instruction uint32
 
 const MAXARG_Bx = (1 << 18) - 1
 const MAXARG_sBx = MAXARG_Bx >> 1
 
+func CreateABC(op, a, b, c int) Instruction {
+	return Instruction(op | a<<6 | b<<23 | c<<14)
+}
+
+func CreateABx(op, a, bx int) Instruction {
+	return Instruction(op | a<<6 | bx<<14)
+}
+
+func CreateAsBx(op, a, sbx int) Instruction {
+	return CreateABx(op, a, sbx+MAXARG_sBx)
+}
+
+func CreateAx(op, ax int) Instruction {
+	return Instruction(op | ax<<6)
+}
+
 func (i Instruction) Opcode() int {
 	return int(i & 0x3f)
 }
@@ -47,3 +65,49 @@ func (i Instruction) BMode() byte {
 func (i Instruction) CMode() byte {
 	return opcodes[i.Opcode()].argCMode
 }
+
+func (i Instruction) TestFlag() bool {
+	return opcodes[i.Opcode()].testFlag != 0
+}
+
+func (i Instruction) SetAFlag() bool {
+	return opcodes[i.Opcode()].setAFlag != 0
+}
+
+/* operands as luac lists them, constants as -1-k */
+func (i Instruction) String() string {
+	s := i.OpName()
+	switch i.OpMode() {
+	case IABC:
+		a, b, c := i.ABC()
+		s += fmt.Sprintf(" %d", a)
+		if i.BMode() != OpArgN {
+			s += fmt.Sprintf(" %d", rkOperand(b))
+		}
+		if i.CMode() != OpArgN {
+			s += fmt.Sprintf(" %d", rkOperand(c))
+		}
+	case IABx:
+		a, bx := i.ABx()
+		s += fmt.Sprintf(" %d", a)
+		switch i.BMode() {
+		case OpArgK:
+			s += fmt.Sprintf(" %d", -1-bx)
+		case OpArgU:
+			s += fmt.Sprintf(" %d", bx)
+		}
+	case IAsBx:
+		a, sbx := i.AsBx()
+		s += fmt.Sprintf(" %d %d", a, sbx)
+	case IAx:
+		s += fmt.Sprintf(" %d", -1-i.Ax())
+	}
+	return s
+}
+
+func rkOperand(x int) int {
+	if x > 0xff {
+		return -1 - (x & 0xff)
+	}
+	return x
+}